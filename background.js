@@ -1,6 +1,26 @@
 // Constants
 const PREVIEW_LENGTH = 30;
 const DEFAULT_HOST = 'No URL';
+const PROTOCOL_VERSION = 1;
+const SUPPORTED_ACTIONS = ['select', 'resync', 'reopen', 'open', 'bookmark', 'history', 'mute', 'screenshot'];
+const UPDATE_DELAY_MS = 100;
+const TRUNCATED_TITLE_LENGTH = 100;
+const FAVICON_SIZE = 32;
+// Icons larger than this as data: URLs are not sent
+const MAX_FAVICON_LENGTH = 256 * 1024;
+// Base64 characters per chunk of a large result, well under the 1 MB
+// message limit and a multiple of 4 so each chunk decodes on its own
+const CHUNK_SIZE = 512 * 1024;
+// Time for a tab switched to for a screenshot to be painted
+const CAPTURE_DELAY_MS = 300;
+const THUMBNAIL_WIDTH = 320;
+// Time a tab must stay shown before its thumbnail is taken
+const THUMBNAIL_DELAY_MS = 1000;
+
+// Set from the host's hello reply
+let hostInfo = null;
+// The host's message size limit, learnt from its first resync request
+let maxMessageSize = 0;
 
 /**
  * Logs a message with timestamp
@@ -27,13 +47,40 @@ function getHostFromUrl(url) {
 /**
  * Processes tabs into a simplified format
  * @param {Array} tabs - Array of Chrome tab objects
- * @returns {Array} Processed tabs with id, title, and host
+ * @returns {Array} Processed tabs with id, title, host, url, position, state and sound
  */
 function processTabs(tabs) {
     return tabs.map(tab => ({
         id: tab.id,
         title: tab.title,
-        host: getHostFromUrl(tab.url)
+        host: getHostFromUrl(tab.url),
+        url: tab.url,
+        lastAccessed: tab.lastAccessed,
+        incognito: tab.incognito,
+        windowId: tab.windowId,
+        index: tab.index,
+        groupId: tab.groupId,
+        pinned: tab.pinned,
+        audible: tab.audible,
+        muted: !!(tab.mutedInfo && tab.mutedInfo.muted)
+    }));
+}
+
+/**
+ * Lists tab groups, or none where the browser has no tab groups
+ * @returns {Promise<Array>} Groups with id, windowId, title, color and collapsed
+ */
+async function queryGroups() {
+    if (!chrome.tabGroups) {
+        return [];
+    }
+    const groups = await chrome.tabGroups.query({});
+    return groups.map(g => ({
+        id: g.id,
+        windowId: g.windowId,
+        title: g.title,
+        color: g.color,
+        collapsed: g.collapsed
     }));
 }
 
@@ -63,16 +110,13 @@ const port = chrome.runtime.connectNative("rofi_chrome_tab");
 port.onMessage.addListener((msg) => {
     log('onMessage: ' + JSON.stringify(msg));
 
-    if (msg.command === 'list') {
-        chrome.tabs.query({})
-            .then(tabs => {
-                const processedTabs = processTabs(tabs);
-                logTabsPreview(processedTabs);
-                port.postMessage(processedTabs);
-            })
-            .catch(error => {
-                console.error('Error listing tabs:', error);
-            });
+    if (msg.command === 'hello') {
+        hostInfo = msg;
+        log(`host ${msg.hostVersion} (protocol ${msg.protocolVersion})`);
+        if (!msg.accepted) {
+            console.error('Host rejected extension protocol ' + PROTOCOL_VERSION);
+        }
+        scheduleThumbnail();
         return;
     }
 
@@ -87,19 +131,62 @@ port.onMessage.addListener((msg) => {
         return;
     }
 
-    if (msg.command === 'count') {
-        chrome.tabs.query({})
-            .then(tabs => {
-                log('postMessage: ' + tabs.length);
-                port.postMessage(tabs.length);
-            })
+    if (msg.command === 'resync') {
+        console.warn('Host dropped a message (' + msg.reason + '), resending tabs');
+        maxMessageSize = msg.maxMessageSize;
+        notifyUpdatedEvent();
+        return;
+    }
+
+    if (msg.command === 'reopen') {
+        reopenTab(msg).catch(error => {
+            console.error('Error reopening tab:', error);
+        });
+        return;
+    }
+
+    if (msg.command === 'open') {
+        openTabs(msg).catch(error => {
+            console.error('Error opening tabs:', error);
+        });
+        return;
+    }
+
+    if (msg.command === 'bookmark') {
+        bookmarkTab(msg).catch(error => {
+            console.error('Error bookmarking tab:', error);
+        });
+        return;
+    }
+
+    if (msg.command === 'history') {
+        respond(msg, chrome.history.search({
+            text: msg.query,
+            startTime: msg.startTime,
+            maxResults: msg.maxResults
+        }).then(items => items.map(item => ({
+            url: item.url,
+            title: item.title,
+            visitCount: item.visitCount,
+            lastVisitTime: item.lastVisitTime
+        }))));
+        return;
+    }
+
+    if (msg.command === 'screenshot') {
+        respond(msg, captureTab(msg.tabId).then(dataUrl => sendChunks(msg, dataUrl)));
+        return;
+    }
+
+    if (msg.command === 'mute') {
+        Promise.all(msg.tabIds.map(id => chrome.tabs.update(id, { muted: msg.muted })))
             .catch(error => {
-                console.error('Error counting tabs:', error);
+                console.error('Error muting tabs:', error);
             });
         return;
     }
-    
-    console.log('Invalid command: ' + msg.command);
+
+    console.log('Unsupported command: ' + msg.command);
 });
 
 port.onDisconnect.addListener(() => {
@@ -108,26 +195,419 @@ port.onDisconnect.addListener(() => {
     }
 });
 
+/**
+ * Answers an action that carried a request ID once its result is ready
+ * @param {Object} msg - The action with requestId
+ * @param {Promise} result - Resolves to the result to send
+ */
+function respond(msg, result) {
+    result
+        .then(value => {
+            port.postMessage({ type: 'response', requestId: msg.requestId, result: value });
+        })
+        .catch(error => {
+            console.error('Error answering ' + msg.command + ':', error);
+            port.postMessage({ type: 'response', requestId: msg.requestId, error: String(error.message || error) });
+        });
+}
+
+/**
+ * Sends the base64 data of a data: URL in chunks ahead of the response
+ * @param {Object} msg - The action with requestId
+ * @param {string} dataUrl - The base64 encoded data: URL
+ * @returns {Object} The result telling the host how many chunks were sent
+ */
+function sendChunks(msg, dataUrl) {
+    const data = dataUrl.slice(dataUrl.indexOf(',') + 1);
+    let chunks = 0;
+    for (let i = 0; i < data.length; i += CHUNK_SIZE) {
+        port.postMessage({ type: 'chunk', requestId: msg.requestId, data: data.slice(i, i + CHUNK_SIZE) });
+        chunks++;
+    }
+    return { chunks };
+}
+
+/**
+ * Switches to a tab and captures it
+ * @param {number} tabId - The tab to capture
+ * @returns {Promise<string>} The PNG as a data: URL
+ */
+async function captureTab(tabId) {
+    let tab = await chrome.tabs.get(tabId);
+    if (!tab.active) {
+        tab = await chrome.tabs.update(tabId, { active: true });
+    }
+    await chrome.windows.update(tab.windowId, { focused: true });
+    await new Promise(resolve => setTimeout(resolve, CAPTURE_DELAY_MS));
+    return chrome.tabs.captureVisibleTab(tab.windowId, { format: 'png' });
+}
+
+/**
+ * Restores a closed tab from the browser's session history, or opens its URL
+ * again where it used to be
+ * @param {Object} msg - The reopen action with url, windowId, index, groupId, pinned and incognito
+ */
+async function reopenTab(msg) {
+    const sessions = await chrome.sessions.getRecentlyClosed();
+    const closed = sessions.find(s => s.tab && s.tab.url === msg.url);
+    if (closed) {
+        await chrome.sessions.restore(closed.tab.sessionId);
+        return;
+    }
+
+    const options = { url: msg.url, index: msg.index, pinned: !!msg.pinned, active: true };
+    let window = null;
+    try {
+        window = await chrome.windows.get(msg.windowId);
+        options.windowId = msg.windowId;
+    } catch {
+        // The window is gone; open in the current one
+        delete options.index;
+    }
+    if (msg.incognito && !(window && window.incognito)) {
+        // Opening it anywhere else would put it in the normal history
+        throw new Error('the incognito window of the tab is gone');
+    }
+    const tab = await chrome.tabs.create(options);
+    if (msg.groupId > 0) {
+        try {
+            await chrome.tabs.group({ groupId: msg.groupId, tabIds: [tab.id] });
+        } catch {
+            // The group is gone
+        }
+    }
+    await chrome.windows.update(tab.windowId, { focused: true });
+}
+
+/**
+ * Opens tabs, in a new window if asked, and recreates their groups
+ * @param {Object} msg - The open action with tabs, groups and newWindow
+ */
+async function openTabs(msg) {
+    if (msg.tabs.length === 0) {
+        return;
+    }
+    let windowId;
+    const created = [];
+    if (msg.newWindow) {
+        const win = await chrome.windows.create({ url: msg.tabs[0].url, focused: true });
+        windowId = win.id;
+        created.push(win.tabs[0]);
+        if (msg.tabs[0].pinned) {
+            await chrome.tabs.update(win.tabs[0].id, { pinned: true });
+        }
+    } else {
+        windowId = (await chrome.windows.getLastFocused()).id;
+    }
+    for (const tab of msg.tabs.slice(created.length)) {
+        created.push(await chrome.tabs.create({ windowId, url: tab.url, pinned: !!tab.pinned, active: false }));
+    }
+
+    for (const group of msg.groups || []) {
+        const tabIds = created.filter((_, i) => msg.tabs[i].groupId === group.id).map(t => t.id);
+        if (tabIds.length === 0) {
+            continue;
+        }
+        const groupId = await chrome.tabs.group({ tabIds, createProperties: { windowId } });
+        if (chrome.tabGroups) {
+            await chrome.tabGroups.update(groupId, {
+                title: group.title || '',
+                color: group.color || 'grey',
+                collapsed: !!group.collapsed
+            });
+        }
+    }
+    await chrome.tabs.update(created[0].id, { active: true });
+    await chrome.windows.update(windowId, { focused: true });
+}
+
+/**
+ * Flattens the bookmark tree into bookmarks with their folder paths
+ * @param {Array} nodes - Bookmark tree nodes
+ * @param {string} path - Titles of the enclosing folders joined by '/'
+ * @param {Array} out - Collected bookmarks with id, title, url and path
+ * @returns {Array} out
+ */
+function flattenBookmarks(nodes, path, out) {
+    for (const node of nodes) {
+        if (node.url) {
+            out.push({ id: node.id, title: node.title, url: node.url, path });
+        } else if (node.children) {
+            const folder = node.title ? (path ? path + '/' + node.title : node.title) : path;
+            flattenBookmarks(node.children, folder, out);
+        }
+    }
+    return out;
+}
+
+/**
+ * Sends every bookmark to the host
+ */
+function notifyBookmarksEvent() {
+    chrome.bookmarks.getTree()
+        .then(tree => {
+            port.postMessage({ type: 'bookmarks', bookmarks: flattenBookmarks(tree, '', []) });
+        })
+        .catch(error => {
+            console.error('Error sending bookmarks:', error);
+        });
+}
+
+let bookmarksTimer = null;
+
+/**
+ * Sends the bookmarks once a burst of bookmark changes has settled
+ */
+function scheduleBookmarksEvent() {
+    clearTimeout(bookmarksTimer);
+    bookmarksTimer = setTimeout(notifyBookmarksEvent, UPDATE_DELAY_MS);
+}
+
+/**
+ * Finds a folder by its path of titles, creating missing folders
+ * @param {string} path - Folder titles joined by '/', e.g. 'Bookmarks bar/Work'
+ * @returns {Promise<string|undefined>} The folder's ID, or undefined for the default folder
+ */
+async function findOrCreateFolder(path) {
+    const titles = path.split('/').filter(t => t !== '');
+    if (titles.length === 0) {
+        return undefined;
+    }
+    const [root] = await chrome.bookmarks.getTree();
+    let parent = root.children.find(n => n.title === titles[0]);
+    if (!parent) {
+        // Missing top level folders go in "Other bookmarks"
+        parent = root.children.find(n => n.id === '2') || root.children[0];
+        titles.unshift(parent.title);
+    }
+    for (const title of titles.slice(1)) {
+        const children = await chrome.bookmarks.getChildren(parent.id);
+        parent = children.find(n => !n.url && n.title === title)
+            || await chrome.bookmarks.create({ parentId: parent.id, title });
+    }
+    return parent.id;
+}
+
+/**
+ * Bookmarks a tab
+ * @param {Object} msg - The bookmark action with tabId and folder
+ */
+async function bookmarkTab(msg) {
+    const tab = await chrome.tabs.get(msg.tabId);
+    const parentId = await findOrCreateFolder(msg.folder || '');
+    await chrome.bookmarks.create({ parentId, title: tab.title, url: tab.url });
+}
+
+// Favicon URL last sent per host, keyed separately for incognito tabs
+const sentFavicons = new Map();
+
+/**
+ * Reads a tab's icon as a data: URL, from the browser's favicon cache unless
+ * the page set a data: URL itself
+ * @param {Object} tab - Chrome tab with favIconUrl
+ * @returns {Promise<string>} The icon as a data: URL
+ */
+async function readFavicon(tab) {
+    if (tab.favIconUrl.startsWith('data:')) {
+        return tab.favIconUrl;
+    }
+    const url = new URL(chrome.runtime.getURL('/_favicon/'));
+    url.searchParams.set('pageUrl', tab.url);
+    url.searchParams.set('size', String(FAVICON_SIZE));
+    const response = await fetch(url);
+    if (!response.ok) {
+        throw new Error('favicon request failed: ' + response.status);
+    }
+    return blobToDataUrl(await response.blob());
+}
+
+/**
+ * Encodes a blob as a data: URL
+ * @param {Blob} blob - The data, with its media type
+ * @returns {Promise<string>} The base64 encoded data: URL
+ */
+async function blobToDataUrl(blob) {
+    const bytes = new Uint8Array(await blob.arrayBuffer());
+    let binary = '';
+    for (const b of bytes) {
+        binary += String.fromCharCode(b);
+    }
+    return 'data:' + (blob.type || 'image/png') + ';base64,' + btoa(binary);
+}
+
+/**
+ * Sends a small image of the tab shown in the last focused window, if the
+ * host asked for thumbnails
+ */
+async function sendThumbnail() {
+    const [tab] = await chrome.tabs.query({ active: true, lastFocusedWindow: true });
+    if (!tab || tab.status !== 'complete' || !/^https?:/.test(tab.url || '')) {
+        return;
+    }
+    const capture = await chrome.tabs.captureVisibleTab(tab.windowId, { format: 'jpeg', quality: 80 });
+    const bitmap = await createImageBitmap(await (await fetch(capture)).blob());
+    const height = Math.round(bitmap.height * THUMBNAIL_WIDTH / bitmap.width);
+    const canvas = new OffscreenCanvas(THUMBNAIL_WIDTH, height);
+    canvas.getContext('2d').drawImage(bitmap, 0, 0, THUMBNAIL_WIDTH, height);
+    const blob = await canvas.convertToBlob({ type: 'image/png' });
+    port.postMessage({ type: 'thumbnail', tabId: tab.id, data: await blobToDataUrl(blob) });
+}
+
+let thumbnailTimer = null;
+
+/**
+ * Takes a thumbnail once the shown tab has settled
+ */
+function scheduleThumbnail() {
+    if (!hostInfo || !hostInfo.thumbnails) {
+        return;
+    }
+    clearTimeout(thumbnailTimer);
+    thumbnailTimer = setTimeout(() => {
+        sendThumbnail().catch(error => {
+            // Browser pages and minimized windows cannot be captured
+            log('No thumbnail: ' + (error.message || error));
+        });
+    }, THUMBNAIL_DELAY_MS);
+}
+
+/**
+ * Sends the icons of hosts whose icon was not sent yet or has changed
+ * @param {Array} tabs - Chrome tab objects
+ */
+async function sendFavicons(tabs) {
+    for (const tab of tabs) {
+        if (!tab.favIconUrl || !/^https?:/.test(tab.url || '')) {
+            continue;
+        }
+        const host = getHostFromUrl(tab.url);
+        const key = (tab.incognito ? 'incognito ' : '') + host;
+        if (sentFavicons.get(key) === tab.favIconUrl) {
+            continue;
+        }
+        sentFavicons.set(key, tab.favIconUrl);
+        try {
+            const data = await readFavicon(tab);
+            if (data.length <= MAX_FAVICON_LENGTH) {
+                port.postMessage({ type: 'favicon', host, incognito: tab.incognito, data });
+            }
+        } catch (error) {
+            console.warn('Error reading favicon of ' + host + ':', error);
+        }
+    }
+}
+
+/**
+ * Guesses the browser product from the user agent client hints
+ * @returns {string} Brand name such as "Google Chrome", or empty if unknown
+ */
+function getBrowserBrand() {
+    if (navigator.brave) {
+        return 'Brave';
+    }
+    const brands = (navigator.userAgentData && navigator.userAgentData.brands) || [];
+    const known = brands.find(b => !/Not.?A.?Brand|^Chromium$/.test(b.brand));
+    if (known) {
+        return known.brand;
+    }
+    return brands.some(b => b.brand === 'Chromium') ? 'Chromium' : '';
+}
+
+/**
+ * Announces the extension's protocol version and supported actions
+ */
+function sendHello() {
+    port.postMessage({
+        type: 'hello',
+        protocolVersion: PROTOCOL_VERSION,
+        extensionVersion: chrome.runtime.getManifest().version,
+        actions: SUPPORTED_ACTIONS,
+        browser: getBrowserBrand()
+    });
+}
+
+/**
+ * Shortens tab titles when a message would exceed the host's size limit
+ * @param {Object} message - The updated event to send
+ * @param {number} maxSize - The host's limit in bytes, if known
+ * @returns {Object} The message, with titles truncated if needed
+ */
+function fitMessage(message, maxSize) {
+    const size = m => new TextEncoder().encode(JSON.stringify(m)).length;
+    if (!maxSize || size(message) <= maxSize) {
+        return message;
+    }
+    const tabs = message.tabs.map(tab => ({
+        ...tab,
+        title: (tab.title || '').slice(0, TRUNCATED_TITLE_LENGTH)
+    }));
+    const fitted = { ...message, tabs };
+    if (size(fitted) > maxSize) {
+        console.error('Tab list exceeds the host limit of ' + maxSize + ' bytes');
+    }
+    return fitted;
+}
+
 /**
  * Notifies about tab updates
  */
 function notifyUpdatedEvent() {
-    chrome.tabs.query({})
-        .then(tabs => {
+    Promise.all([chrome.tabs.query({}), queryGroups()])
+        .then(([tabs, groups]) => {
             const processedTabs = processTabs(tabs);
             logTabsPreview(processedTabs);
-            port.postMessage({
+            port.postMessage(fitMessage({
                 type: 'updated',
-                tabs: processedTabs
-            });
+                tabs: processedTabs,
+                groups
+            }, maxMessageSize));
+            return sendFavicons(tabs);
         })
         .catch(error => {
             console.error('Error notifying update:', error);
         });
 }
 
+let updateTimer = null;
+
+/**
+ * Notifies about tab updates once a burst of tab events has settled
+ */
+function scheduleUpdatedEvent() {
+    clearTimeout(updateTimer);
+    updateTimer = setTimeout(notifyUpdatedEvent, UPDATE_DELAY_MS);
+}
+
 chrome.tabs.onActivated.addListener(() => {
     notifyUpdatedEvent();
+    scheduleThumbnail();
+});
+chrome.tabs.onCreated.addListener(scheduleUpdatedEvent);
+chrome.tabs.onRemoved.addListener(scheduleUpdatedEvent);
+chrome.tabs.onMoved.addListener(scheduleUpdatedEvent);
+chrome.tabs.onAttached.addListener(scheduleUpdatedEvent);
+if (chrome.tabGroups) {
+    chrome.tabGroups.onUpdated.addListener(scheduleUpdatedEvent);
+}
+chrome.tabs.onUpdated.addListener((tabId, changeInfo, tab) => {
+    if (changeInfo.favIconUrl) {
+        sendFavicons([tab]);
+    }
+    if (changeInfo.status === 'complete' && tab.active) {
+        scheduleThumbnail();
+    }
+    if (changeInfo.url || changeInfo.title || changeInfo.groupId !== undefined || changeInfo.pinned !== undefined ||
+        changeInfo.audible !== undefined || changeInfo.mutedInfo) {
+        scheduleUpdatedEvent();
+    }
 });
 
+chrome.bookmarks.onCreated.addListener(scheduleBookmarksEvent);
+chrome.bookmarks.onRemoved.addListener(scheduleBookmarksEvent);
+chrome.bookmarks.onChanged.addListener(scheduleBookmarksEvent);
+chrome.bookmarks.onMoved.addListener(scheduleBookmarksEvent);
+chrome.bookmarks.onImportEnded.addListener(scheduleBookmarksEvent);
+
+sendHello();
 notifyUpdatedEvent();
+notifyBookmarksEvent();
@@ -0,0 +1,25 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"rofi-chrome-tab/internal/doctor"
+)
+
+func runDoctor(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("doctor: unexpected argument: %s", fs.Arg(0))
+	}
+
+	if doctor.Print(os.Stdout, doctor.Run(doctor.DefaultEnv())) {
+		return errors.New("some checks failed")
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"rofi-chrome-tab/internal/install"
+)
+
+// installFlags are shared by install and uninstall.
+type installFlags struct {
+	browser string
+	system  bool
+	dryRun  bool
+}
+
+func (f *installFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.browser, "browser", "all", "browser: "+strings.Join(install.BrowserNames(), ", ")+" or all")
+	fs.BoolVar(&f.system, "system", false, "use the system-wide manifest directory (needs root)")
+	fs.BoolVar(&f.dryRun, "dry-run", false, "print what would be done without changing anything")
+}
+
+func (f *installFlags) options() (install.Options, error) {
+	browsers, err := install.Lookup(f.browser)
+	if err != nil {
+		return install.Options{}, err
+	}
+	opts := install.Options{Browsers: browsers, System: f.system, DryRun: f.dryRun}
+	if !f.system {
+		if opts.ConfigHome, err = install.ConfigHome(); err != nil {
+			return install.Options{}, err
+		}
+	}
+	return opts, nil
+}
+
+func runInstall(args []string) error {
+	var f installFlags
+	var ids, path string
+	fs := flag.NewFlagSet("install", flag.ContinueOnError)
+	f.register(fs)
+	fs.StringVar(&ids, "extension-id", "", "ID of the installed extension; comma separated for several")
+	fs.StringVar(&path, "path", "", "absolute path of the host binary (default: this binary)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("install: unexpected argument: %s", fs.Arg(0))
+	}
+	if ids == "" {
+		return fmt.Errorf("install: --extension-id is required (see chrome://extensions)")
+	}
+
+	if path == "" {
+		exe, err := install.Executable()
+		if err != nil {
+			return err
+		}
+		path = exe
+	}
+	m, err := install.NewManifest(path, strings.Split(ids, ","))
+	if err != nil {
+		return err
+	}
+	opts, err := f.options()
+	if err != nil {
+		return err
+	}
+	return install.Install(m, opts, os.Stdout)
+}
+
+func runUninstall(args []string) error {
+	var f installFlags
+	fs := flag.NewFlagSet("uninstall", flag.ContinueOnError)
+	f.register(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("uninstall: unexpected argument: %s", fs.Arg(0))
+	}
+
+	opts, err := f.options()
+	if err != nil {
+		return err
+	}
+	return install.Uninstall(opts, os.Stdout)
+}
@@ -1,13 +1,40 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 
 	"rofi-chrome-tab/internal/app"
 )
 
+// subcommands are run from a terminal. Without one the binary runs as the
+// native messaging host; browsers pass the extension origin as the first
+// argument.
+var subcommands = map[string]func(args []string) error{
+	"install":   runInstall,
+	"uninstall": runUninstall,
+	"doctor":    runDoctor,
+	"sockets":   runSockets,
+}
+
 func main() {
-	if err := app.Run(); err != nil {
+	if len(os.Args) > 1 {
+		if run, ok := subcommands[os.Args[1]]; ok {
+			err := run(os.Args[2:])
+			if errors.Is(err, flag.ErrHelp) {
+				return
+			}
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "rofi-chrome-tab:", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
+	if err := app.Main(); err != nil {
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/registry"
+)
+
+// runSockets prints the command socket of every running host, or of the host
+// with the given pid, so that scripts need not know socket_dir.
+func runSockets(args []string) error {
+	fs := flag.NewFlagSet("sockets", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("sockets: unexpected argument: %s", fs.Arg(1))
+	}
+	pid := 0
+	if fs.NArg() == 1 {
+		n, err := strconv.Atoi(fs.Arg(0))
+		if err != nil || n <= 0 {
+			return fmt.Errorf("sockets: invalid pid: %s", fs.Arg(0))
+		}
+		pid = n
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		return err
+	}
+	instances, err := registry.List(cfg.SocketDir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, inst := range instances {
+		if !inst.Alive() || (pid != 0 && inst.PID != pid) {
+			continue
+		}
+		fmt.Fprintln(os.Stdout, inst.Socket)
+		found = true
+	}
+	if pid != 0 && !found {
+		return fmt.Errorf("sockets: no running host with pid %d", pid)
+	}
+	return nil
+}
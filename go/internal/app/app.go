@@ -2,81 +2,672 @@ package app
 
 import (
 	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"os"
+	"os/signal"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
+	"github.com/godbus/dbus/v5"
+
+	"rofi-chrome-tab/internal/browser"
+	"rofi-chrome-tab/internal/closedtabs"
 	"rofi-chrome-tab/internal/command_receiver"
-	"rofi-chrome-tab/internal/debug"
+	"rofi-chrome-tab/internal/config"
 	"rofi-chrome-tab/internal/event_receiver"
+	"rofi-chrome-tab/internal/export"
+	"rofi-chrome-tab/internal/focus"
+	"rofi-chrome-tab/internal/listfmt"
 	"rofi-chrome-tab/internal/logging"
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/mpris"
+	"rofi-chrome-tab/internal/nativemsg"
+	"rofi-chrome-tab/internal/privacy"
 	"rofi-chrome-tab/internal/protocol"
+	"rofi-chrome-tab/internal/registry"
+	"rofi-chrome-tab/internal/session"
+	"rofi-chrome-tab/internal/version"
 )
 
-// Main
-func Run() error {
+// Options configure a host. Zero fields take the defaults used in production.
+type Options struct {
+	Context context.Context
+	// Stdin and Stdout are the native messaging pipes to the extension.
+	Stdin  io.Reader
+	Stdout io.Writer
+	Config config.Config
+	PID    int
+	// DetectBrowser identifies the browser that started the host.
+	DetectBrowser func() (browser.Info, error)
+	Clock         func() time.Time
+	// Logger is tagged with the component of each part of the host.
+	Logger *slog.Logger
+	// Metrics counts what the host does.
+	Metrics *metrics.Registry
+	// ConnectBus opens a connection to the D-Bus session bus for MPRIS.
+	ConnectBus func() (*dbus.Conn, error)
+}
+
+func (o Options) withDefaults() Options {
+	if o.Context == nil {
+		o.Context = context.Background()
+	}
+	if o.Stdin == nil {
+		o.Stdin = os.Stdin
+	}
+	if o.Stdout == nil {
+		o.Stdout = os.Stdout
+	}
+	if o.PID == 0 {
+		o.PID = os.Getpid()
+	}
+	if o.DetectBrowser == nil {
+		o.DetectBrowser = func() (browser.Info, error) { return browser.Detect("/proc", os.Getppid()) }
+	}
+	if o.Clock == nil {
+		o.Clock = time.Now
+	}
+	if o.Logger == nil {
+		o.Logger = slog.Default()
+	}
+	if o.Metrics == nil {
+		o.Metrics = metrics.Default
+	}
+	if o.ConnectBus == nil {
+		o.ConnectBus = func() (*dbus.Conn, error) { return dbus.ConnectSessionBus() }
+	}
+	return o
+}
+
+// Main runs the host with the user's configuration until it is signalled or
+// the browser disconnects.
+func Main() error {
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return err
+	}
+
 	// Set up log file
-	logCloser, err := logging.SetupLogging("/tmp/rofi-chrome-tab.log")
+	logCloser, err := logging.SetupLogging(cfg.Log)
 	if err != nil {
 		return err
 	}
 	defer logCloser.Close()
 
-	pid := os.Getpid()
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	return Run(Options{Context: ctx, Config: cfg})
+}
+
+// Run serves the extension on opts.Stdin/opts.Stdout and commands on the
+// host's socket until the context is done or the extension disconnects.
+func Run(opts Options) error {
+	opts = opts.withDefaults()
+	cfg := opts.Config
+	logger := opts.Logger.With("component", "app")
+	ctx, cancel := context.WithCancel(opts.Context)
+	defer cancel()
+
+	h := &host{cfg: cfg, pid: opts.PID, out: nativemsg.NewWriter(opts.Stdout), now: opts.Clock, logger: logger, metrics: opts.Metrics}
 	evCh := make(chan protocol.Event, 1)
 	cmdCh := make(chan command_receiver.CommandWithConn, 1)
-	var tabs []protocol.Tab
 
-	event_receiver.Start(os.Stdin, evCh)
-	_ = command_receiver.Start(pid, debug.IsDebugMode(), cmdCh)
+	detected, err := opts.DetectBrowser()
+	if err != nil {
+		logger.Warn("cannot identify browser", "err", err)
+	}
+	h.snapshotKey = detected.Key()
+	h.publish(&state{browser: detected, closed: closedtabs.New(cfg.MaxClosedTabs)})
+
+	stdinClosed := event_receiver.Start(ctx, opts.Stdin, evCh, opts.Logger.With("component", "event_receiver"), opts.Metrics)
+	socketPath := cfg.SocketPath(opts.PID)
+	limits := command_receiver.Limits{Timeout: cfg.Commands.Timeout(), MaxConns: cfg.Commands.MaxConnections}
+	if err := command_receiver.Start(ctx, socketPath, limits, cmdCh, opts.Logger.With("component", "command_receiver"), opts.Metrics); err != nil {
+		logger.Error("cannot start command receiver", "err", err)
+		return err
+	}
+	defer os.Remove(socketPath)
+
+	inst := registry.Instance{
+		PID:         opts.PID,
+		Socket:      socketPath,
+		HostVersion: version.String(),
+		Started:     opts.Clock(),
+		Browser:     detected,
+	}
+	if err := registry.Write(cfg.SocketDir, inst); err != nil {
+		logger.Warn("cannot register instance", "err", err)
+	}
+	defer registry.Remove(cfg.SocketDir, opts.PID)
+
+	if cfg.MetricsSocket != "" {
+		if err := metrics.Serve(ctx, cfg.MetricsSocketPath(opts.PID), opts.Metrics, opts.Logger.With("component", "metrics")); err != nil {
+			logger.Error("cannot serve metrics", "err", err)
+		}
+	}
+
+	// Snapshot the tabs periodically and once more on the way out
+	snap := &snapshotter{h: h}
+	snapDone := make(chan struct{})
+	if interval := cfg.Snapshots.Interval(); interval > 0 {
+		go func() {
+			defer close(snapDone)
+			snap.run(ctx.Done(), interval)
+		}()
+	} else {
+		close(snapDone)
+	}
+	defer func() {
+		cancel()
+		<-snapDone
+		if err := snap.take(); err != nil {
+			logger.Error("cannot save snapshot", "err", err)
+		}
+	}()
+
+	// Publish tabs playing sound as media players
+	var bridge *mpris.Bridge
+	if cfg.MPRIS {
+		identity := detected.Product
+		if identity == "" {
+			identity = "Browser"
+		}
+		bridge = mpris.New(opts.ConnectBus, mediaController{h}, identity, opts.PID, logger)
+		bridgeDone := make(chan struct{})
+		go func() {
+			defer close(bridgeDone)
+			bridge.Run(ctx.Done())
+		}()
+		defer func() {
+			cancel()
+			<-bridgeDone
+		}()
+	}
+
+	// Thumbnails only make sense within this browser session; clear any
+	// left by an earlier host with the same pid
+	if cfg.Thumbnails.Enabled {
+		if thumbs, err := h.thumbnails(); err == nil {
+			thumbs.Clear()
+			defer thumbs.Clear()
+		}
+	}
+
+	// Commands are served concurrently from state snapshots; wait for them
+	// before the deferred cleanups remove the socket and registry entry.
+	var serving sync.WaitGroup
+	defer serving.Wait()
 
 	for {
 		select {
+		case <-ctx.Done():
+			logger.Info("shutting down")
+			return nil
+		case <-stdinClosed:
+			logger.Info("extension disconnected, shutting down")
+			return nil
 		case ev := <-evCh:
-			if err := handleEvent(&tabs, ev); err != nil {
-				log.Println("Error handling event:", err)
+			if err := h.handleEvent(ev); err != nil {
+				logger.Error("error handling event", "event", ev.Type(), "err", err)
 			}
-		case cw := <-cmdCh:
-			if err := executeCommand(tabs, cw.Cmd, cw.Conn, pid); err != nil {
-				log.Println("Command error:", err)
+			if bridge != nil {
+				bridge.Update(mprisPlayers(h.state().tabs, cfg))
 			}
-			cw.Conn.Close()
+			if b := h.state().browser; b != inst.Browser {
+				inst.Browser = b
+				if err := registry.Write(cfg.SocketDir, inst); err != nil {
+					logger.Warn("cannot register instance", "err", err)
+				}
+			}
+		case cw := <-cmdCh:
+			serving.Add(1)
+			go func() {
+				defer serving.Done()
+				h.serve(cw)
+			}()
 		}
 	}
 }
 
-func handleEvent(tabs *[]protocol.Tab, ev protocol.Event) error {
+// serve executes one command and closes its connection. The connection's
+// deadline, set by the command receiver, bounds a slow client.
+func (h *host) serve(cw command_receiver.CommandWithConn) {
+	defer cw.Conn.Close()
+	err := h.executeCommand(cw.Cmd, cw.Conn)
+	h.metrics.CommandServed(cw.Cmd.Name(), err)
+	if err != nil {
+		h.logger.Error("command error", "command", cw.Cmd.Name(), "err", err)
+	}
+}
+
+// state is everything the host knows about the browser it serves. A state is
+// never modified once published; event handlers publish a changed copy.
+type state struct {
+	tabs    []protocol.Tab
+	groups  []protocol.Group
+	ext     extension
+	browser browser.Info
+	// stale is set when a message from the extension was dropped, until the
+	// next tab update arrives.
+	stale     bool
+	closed    closedtabs.Journal
+	bookmarks []protocol.Bookmark
+}
+
+// host holds what event and command handlers need.
+type host struct {
+	cfg config.Config
+	pid int
+	// out is the native messaging pipe to the extension.
+	out     *nativemsg.Writer
+	now     func() time.Time
+	logger  *slog.Logger
+	metrics *metrics.Registry
+	// snapshotKey names the snapshot directory of the profile. It is taken
+	// from the browser detected at start and never follows what the
+	// extension reports later, so one host keeps one directory.
+	snapshotKey string
+	snap        atomic.Pointer[state]
+	// requests are the commands waiting for the extension to respond.
+	requests requests
+}
+
+// state returns the current snapshot.
+func (h *host) state() *state {
+	if st := h.snap.Load(); st != nil {
+		return st
+	}
+	return &state{}
+}
+
+func (h *host) publish(st *state) {
+	h.snap.Store(st)
+}
+
+// handleEvent applies ev to the state. Events are handled one at a time, by
+// the main loop only.
+func (h *host) handleEvent(ev protocol.Event) error {
+	st := *h.state()
 	switch e := ev.(type) {
 	case protocol.UpdatedEvent:
-		*tabs = e.Tabs
+		st.closed = st.closed.Update(st.tabs, e.Tabs, h.now(), h.journaled)
+		h.dropThumbnails(e.Tabs)
+		st.tabs = e.Tabs
+		st.groups = e.Groups
+		st.stale = false
+		h.publish(&st)
+		h.logger.Debug("tabs updated", "count", len(e.Tabs))
+		return nil
+	case protocol.HelloEvent:
+		st.ext = extension{hello: &e}
+		st.browser = st.browser.Merge(browser.Info{Product: browser.FromBrand(e.Browser)})
+		h.publish(&st)
+		h.logger.Info("extension connected",
+			"version", e.ExtensionVersion, "protocol", e.ProtocolVersion, "actions", e.Actions, "browser", st.browser.String())
+		reply := protocol.HelloAction{
+			ProtocolVersion: protocol.Version,
+			HostVersion:     version.String(),
+			Accepted:        st.ext.accepted(),
+			Thumbnails:      h.cfg.Thumbnails.Enabled,
+		}
+		return h.sendAction(st.ext, reply)
+	case protocol.BookmarksEvent:
+		st.bookmarks = e.Bookmarks
+		h.publish(&st)
+		h.logger.Debug("bookmarks updated", "count", len(e.Bookmarks))
+		return nil
+	case protocol.FaviconEvent:
+		h.storeFavicon(e)
+		return nil
+	case protocol.ThumbnailEvent:
+		h.storeThumbnail(&st, e)
+		return nil
+	case protocol.ChunkEvent:
+		if !h.requests.chunk(e) {
+			h.logger.Debug("chunk for a request no longer waiting", "id", e.RequestID)
+		}
+		return nil
+	case protocol.ResponseEvent:
+		if !h.requests.resolve(e) {
+			h.logger.Debug("response to a request no longer waiting", "id", e.RequestID)
+		}
 		return nil
+	case protocol.DroppedEvent:
+		if st.stale {
+			// A resync is already pending; its reply may have been the
+			// message dropped, so don't ask again in a loop
+			return nil
+		}
+		st.stale = true
+		h.publish(&st)
+		h.logger.Warn("tab state is stale, asking the extension to resync", "reason", e.Reason)
+		return h.sendAction(st.ext, protocol.ResyncAction{
+			Reason:         e.Reason,
+			MaxMessageSize: nativemsg.DefaultMaxIncoming,
+		})
 	default:
 		return fmt.Errorf("unknown event type: %T", ev)
 	}
 }
 
-func executeCommand(tabs []protocol.Tab, cmd protocol.Command, conn net.Conn, pid int) error {
+// executeCommand serves cmd from the current snapshot. It may run on any
+// goroutine.
+func (h *host) executeCommand(cmd protocol.Command, conn net.Conn) error {
+	cfg, st := h.cfg, h.state()
 	switch c := cmd.(type) {
 	case protocol.ListCommand:
-		return listTabs(conn, tabs, pid)
+		listCfg := cfg.List
+		if c.Template != "" {
+			listCfg.Template = c.Template
+		}
+		if !matchesBrowser(st.browser, c.Browser, c.Profile) {
+			return nil
+		}
+		mode := cfg.List.Incognito
+		if c.Incognito != "" {
+			mode = c.Incognito
+		}
+		inst := registry.Instance{PID: h.pid, Browser: st.browser}
+		tabs := privacy.FilterIncognito(filterTabs(st.tabs, cfg), mode)
+		return listTabs(conn, redactTabs(tabs, privacy.New(cfg.Privacy)), inst, st.stale, listCfg, h.rowImages(), h.now)
 	case protocol.SelectCommand:
-		return protocol.SendAction(os.Stdout, protocol.SelectAction(c))
+		if tab, ok := findTab(st.tabs, c.TabID); ok {
+			h.logger.Debug("selecting tab", privacy.New(cfg.Privacy).LogTab("tab", tab))
+		}
+		if err := h.sendAction(st.ext, protocol.SelectAction(c)); err != nil {
+			return err
+		}
+		return focus.Focus(cfg.FocusBackend)
+	case protocol.ClosedCommand:
+		return listClosed(conn, st.closed, h.listable, cfg.List.Format, h.now())
+	case protocol.ReopenCommand:
+		return h.reopen(conn, st, c.N)
+	case protocol.UndoCommand:
+		return h.reopen(conn, st, 1)
+	case protocol.SessionCommand:
+		return h.session(conn, st, c)
+	case protocol.SnapshotsCommand, protocol.SnapshotRestoreCommand:
+		return h.snapshots(conn, st, c)
+	case protocol.ExportCommand:
+		return h.export(conn, st, c)
+	case protocol.BookmarksCommand:
+		return h.bookmarks(conn, st)
+	case protocol.OpenBookmarkCommand:
+		return h.openBookmark(conn, st, c.ID)
+	case protocol.BookmarkCommand:
+		return h.bookmark(conn, st, c)
+	case protocol.HistoryCommand:
+		return h.history(conn, st, c)
+	case protocol.OpenURLCommand:
+		return h.openURL(conn, st, c.URL)
+	case protocol.LaunchCommand:
+		return h.launch(conn, st, c)
+	case protocol.MediaCommand:
+		return h.media(conn, st, c)
+	case protocol.ScreenshotCommand:
+		return h.screenshot(conn, st, c)
+	case protocol.VersionCommand:
+		_, err := fmt.Fprintf(conn, "host: %s\nprotocol: %d\nextension: %s\nbrowser: %s\n",
+			version.String(), protocol.Version, st.ext.describe(), st.browser)
+		return err
+	case protocol.PingCommand:
+		_, err := fmt.Fprintf(conn, "pong host=%s extension=%s\n", version.String(), st.ext.version())
+		return err
+	case protocol.StatsCommand:
+		enc := json.NewEncoder(conn)
+		enc.SetIndent("", "  ")
+		return enc.Encode(stats{
+			Snapshot: h.metrics.Snapshot(),
+			Stale:    st.stale,
+			Playing:  nowPlaying(st.tabs, privacy.New(cfg.Privacy)),
+		})
+	case protocol.LogLevelCommand:
+		if c.Level != "" {
+			if err := logging.SetLevel(c.Level); err != nil {
+				fmt.Fprintln(conn, err)
+				return err
+			}
+		}
+		_, err := fmt.Fprintln(conn, logging.Level())
+		return err
 	default:
 		return fmt.Errorf("unknown command type: %T", cmd)
 	}
 }
 
-func listTabs(w io.Writer, tabs []protocol.Tab, pid int) error {
-	writer := bufio.NewWriter(w)
-	defer writer.Flush()
+// journaled reports whether a closed tab is recorded in the journal.
+func (h *host) journaled(tab protocol.Tab) bool {
+	return !h.cfg.IsExcluded(tab.Host) && privacy.New(h.cfg.Privacy).Persistable(tab)
+}
+
+// listable reports whether tab passes the filters of list: excluded hosts
+// and the configured incognito mode.
+func (h *host) listable(tab protocol.Tab) bool {
+	return len(privacy.FilterIncognito(filterTabs([]protocol.Tab{tab}, h.cfg), h.cfg.List.Incognito)) == 1
+}
+
+// reopen asks the extension to restore the nth most recently closed tab. The
+// entry leaves the journal once the tab shows up again. A private tab is only
+// reopened into its incognito window, which must still be open.
+func (h *host) reopen(conn net.Conn, st *state, n int) error {
+	reply := func(err error) error {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	entry, ok := st.closed.Get(n)
+	if !ok || !h.listable(entry.Tab) {
+		return reply(fmt.Errorf("no closed tab %d (%d remembered)", n, st.closed.Len()))
+	}
+	tab := entry.Tab
+	if tab.Incognito && !slices.ContainsFunc(st.tabs, func(t protocol.Tab) bool {
+		return t.Incognito && t.WindowID == tab.WindowID
+	}) {
+		return reply(fmt.Errorf("closed tab %d was private and its incognito window is gone", n))
+	}
+	a := protocol.ReopenAction{URL: tab.URL, WindowID: tab.WindowID, Index: tab.Index, Pinned: tab.Pinned, Incognito: tab.Incognito}
+	if tab.Grouped() {
+		a.GroupID = tab.GroupID
+	}
+	if err := h.sendAction(st.ext, a); err != nil {
+		return err
+	}
+	return focus.Focus(h.cfg.FocusBackend)
+}
+
+// export writes the tabs selected by c as a link list. Tabs that may not be
+// persisted are left out, since exports end up in documents.
+func (h *host) export(conn net.Conn, st *state, c protocol.ExportCommand) error {
+	policy := privacy.New(h.cfg.Privacy)
+	keep := policy.Persistable
+	if c.Group != "" {
+		ids := map[int]bool{}
+		for _, g := range st.groups {
+			if strings.EqualFold(g.Title, c.Group) || strconv.Itoa(g.ID) == c.Group {
+				ids[g.ID] = true
+			}
+		}
+		if len(ids) == 0 {
+			err := fmt.Errorf("no tab group %q", c.Group)
+			fmt.Fprintln(conn, err)
+			return err
+		}
+		keep = func(tab protocol.Tab) bool { return ids[tab.GroupID] && policy.Persistable(tab) }
+	}
+
+	tabs := privacy.FilterIncognito(filterTabs(st.tabs, h.cfg), h.cfg.List.Incognito)
+	s := session.Build("export", h.now(), tabs, st.groups, c.WindowID, keep)
+	if s.TabCount() == 0 {
+		err := errors.New("no tabs to export")
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	return export.Write(conn, c.Format, s)
+}
+
+// sendAction sends a to the extension, recording how long the write took.
+// Actions the extension did not announce are refused.
+func (h *host) sendAction(ext extension, a protocol.Action) error {
+	if _, ok := a.(protocol.HelloAction); !ok {
+		if err := ext.supports(a.Type()); err != nil {
+			return err
+		}
+	}
+
+	start := time.Now()
+	err := protocol.SendAction(h.out, a)
+	h.metrics.ObserveAction(a.Type(), time.Since(start))
+	return err
+}
+
+// matchesBrowser reports whether the browser matches the product and profile
+// filters of a list command; empty filters match anything. Profiles match by
+// name or directory.
+func matchesBrowser(info browser.Info, product, profile string) bool {
+	if product != "" && !strings.EqualFold(info.Product, product) {
+		return false
+	}
+	if profile != "" && !strings.EqualFold(info.ProfileName, profile) && !strings.EqualFold(info.ProfileDir, profile) {
+		return false
+	}
+	return true
+}
 
+func findTab(tabs []protocol.Tab, id int) (protocol.Tab, bool) {
 	for _, tab := range tabs {
-		line := fmt.Sprintf("%d,%d,%s,%s", pid, tab.ID, tab.Host, tab.Title)
-		if _, err := writer.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("write error: %v", err)
+		if tab.ID == id {
+			return tab, true
 		}
 	}
+	return protocol.Tab{}, false
+}
+
+// redactTabs returns a copy of tabs with redacted hosts hidden.
+func redactTabs(tabs []protocol.Tab, policy privacy.Policy) []protocol.Tab {
+	redacted := make([]protocol.Tab, len(tabs))
+	for i, tab := range tabs {
+		redacted[i] = policy.Redact(tab)
+	}
+	return redacted
+}
+
+// filterTabs drops tabs whose host matches one of the excluded hosts.
+func filterTabs(tabs []protocol.Tab, cfg config.Config) []protocol.Tab {
+	if len(cfg.ExcludedHosts) == 0 {
+		return tabs
+	}
+	filtered := make([]protocol.Tab, 0, len(tabs))
+	for _, tab := range tabs {
+		if !cfg.IsExcluded(tab.Host) {
+			filtered = append(filtered, tab)
+		}
+	}
+	return filtered
+}
+
+// sortTabs returns a sorted copy of tabs; "none" keeps the browser order.
+func sortTabs(tabs []protocol.Tab, by string) []protocol.Tab {
+	sorted := append([]protocol.Tab(nil), tabs...)
+	switch by {
+	case "id":
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+	case "title":
+		sort.SliceStable(sorted, func(i, j int) bool {
+			return strings.ToLower(sorted[i].Title) < strings.ToLower(sorted[j].Title)
+		})
+	case "host":
+		sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Host < sorted[j].Host })
+	}
+	return sorted
+}
+
+// stats is the reply to the stats command.
+type stats struct {
+	metrics.Snapshot
+	// Stale reports that tabs may be out of date because a message from the
+	// extension was dropped.
+	Stale bool `json:"stale"`
+	// Playing lists the tabs that can be heard, most recently used first.
+	Playing []playing `json:"playing"`
+}
+
+// listSeparator returns the field separator of a list format for outputs
+// that have no template.
+func listSeparator(format string) string {
+	if format == "tsv" {
+		return "\t"
+	}
+	return ","
+}
+
+// listClosed writes one row per closed tab that satisfies show, most recent
+// first: its number for reopen, when it was closed, its host and its title.
+func listClosed(w io.Writer, journal closedtabs.Journal, show func(protocol.Tab) bool, format string, now time.Time) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for i, e := range journal.Entries() {
+		if !show(e.Tab) {
+			continue
+		}
+		fmt.Fprintf(writer, "%d%s%s%s%s%s%s\n", i+1,
+			sep, listfmt.RelTime(e.Closed, now),
+			sep, listfmt.Sanitize(e.Tab.Host),
+			sep, listfmt.Sanitize(e.Tab.Title))
+	}
+	return writer.Flush()
+}
+
+// listTabs writes one row per tab; relative times are measured against now.
+// stale marks every row as possibly out of date. images finds the icon and
+// thumbnail files of rows.
+func listTabs(w io.Writer, tabs []protocol.Tab, inst registry.Instance, stale bool, cfg config.ListConfig, images rowImages, now func() time.Time) error {
+	tmpl, err := listfmt.Parse(cfg.RowTemplate())
+	if err != nil {
+		return fmt.Errorf("invalid template: %v", err)
+	}
+	tmpl.SetClock(now)
+
+	sorted := sortTabs(tabs, cfg.Sort)
+	rows := make([]listfmt.Row, len(sorted))
+	for i, tab := range sorted {
+		rows[i] = listfmt.Row{
+			PID:          inst.PID,
+			Browser:      listfmt.Sanitize(inst.Browser.Product),
+			Profile:      listfmt.Sanitize(inst.Browser.Profile()),
+			ID:           tab.ID,
+			Host:         listfmt.Sanitize(tab.Host),
+			Title:        listfmt.Sanitize(tab.Title),
+			LastAccessed: tab.LastAccessedTime(),
+			Stale:        stale,
+			Audible:      tab.Audible,
+			Muted:        tab.Muted,
+		}
+		if images.icon != nil {
+			rows[i].Icon = images.icon(tab.Host)
+		}
+		if images.thumbnail != nil {
+			rows[i].Thumbnail = images.thumbnail(tab.ID)
+		}
+	}
+
+	writer := bufio.NewWriter(w)
+	defer writer.Flush()
+
+	if err := tmpl.Execute(writer, rows); err != nil {
+		return fmt.Errorf("write error: %v", err)
+	}
 	return nil
 }
@@ -2,9 +2,23 @@ package app
 
 import (
 	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
 	"testing"
+	"time"
 
+	"rofi-chrome-tab/internal/browser"
+	"rofi-chrome-tab/internal/closedtabs"
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/logging"
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/mpris"
+	"rofi-chrome-tab/internal/nativemsg"
 	"rofi-chrome-tab/internal/protocol"
+	"rofi-chrome-tab/internal/registry"
 )
 
 func TestListTabs(t *testing.T) {
@@ -39,7 +53,7 @@ func TestListTabs(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var buf bytes.Buffer
-			err := listTabs(&buf, tabs, tt.pid)
+			err := listTabs(&buf, tabs, registry.Instance{PID: tt.pid}, false, config.Default().List, rowImages{}, time.Now)
 			if err != nil {
 				t.Fatalf("listTabs() error = %v", err)
 			}
@@ -55,7 +69,7 @@ func TestListTabs(t *testing.T) {
 func TestListTabsEmptyTabs(t *testing.T) {
 	// Set up empty tabs
 	var buf bytes.Buffer
-	err := listTabs(&buf, nil, 12345)
+	err := listTabs(&buf, nil, registry.Instance{PID: 12345}, false, config.Default().List, rowImages{}, time.Now)
 	if err != nil {
 		t.Fatalf("listTabs() error = %v", err)
 	}
@@ -65,3 +79,299 @@ func TestListTabsEmptyTabs(t *testing.T) {
 		t.Errorf("listTabs() with empty tabs output = %q, want empty string", got)
 	}
 }
+
+func TestListTabsSanitizesFields(t *testing.T) {
+	tabs := []protocol.Tab{
+		{ID: 1, Title: "evil\nfake,row\x00icon\x1fx", Host: "example.com\r"},
+	}
+	var buf bytes.Buffer
+	if err := listTabs(&buf, tabs, registry.Instance{PID: 7}, false, config.Default().List, rowImages{}, time.Now); err != nil {
+		t.Fatalf("listTabs() error = %v", err)
+	}
+
+	want := "7,1,example.com ,evil fake,row icon x\n"
+	if got := buf.String(); got != want {
+		t.Errorf("listTabs() output = %q, want %q", got, want)
+	}
+}
+
+func TestListTabsFormatAndSort(t *testing.T) {
+	tabs := []protocol.Tab{
+		{ID: 2, Title: "beta", Host: "b.example.com"},
+		{ID: 1, Title: "Alpha", Host: "c.example.com"},
+		{ID: 3, Title: "gamma", Host: "a.example.com"},
+	}
+
+	tests := []struct {
+		name       string
+		cfg        config.ListConfig
+		wantOutput string
+	}{
+		{
+			name:       "csv unsorted",
+			cfg:        config.ListConfig{Format: "csv", Sort: "none"},
+			wantOutput: "7,2,b.example.com,beta\n7,1,c.example.com,Alpha\n7,3,a.example.com,gamma\n",
+		},
+		{
+			name:       "tsv by id",
+			cfg:        config.ListConfig{Format: "tsv", Sort: "id"},
+			wantOutput: "7\t1\tc.example.com\tAlpha\n7\t2\tb.example.com\tbeta\n7\t3\ta.example.com\tgamma\n",
+		},
+		{
+			name:       "csv by title ignores case",
+			cfg:        config.ListConfig{Format: "csv", Sort: "title"},
+			wantOutput: "7,1,c.example.com,Alpha\n7,2,b.example.com,beta\n7,3,a.example.com,gamma\n",
+		},
+		{
+			name:       "csv by host",
+			cfg:        config.ListConfig{Format: "csv", Sort: "host"},
+			wantOutput: "7,3,a.example.com,gamma\n7,2,b.example.com,beta\n7,1,c.example.com,Alpha\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := listTabs(&buf, tabs, registry.Instance{PID: 7}, false, tt.cfg, rowImages{}, time.Now); err != nil {
+				t.Fatalf("listTabs() error = %v", err)
+			}
+			if got := buf.String(); got != tt.wantOutput {
+				t.Errorf("listTabs() output = %q, want %q", got, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestFilterTabsExcludedHosts(t *testing.T) {
+	tabs := []protocol.Tab{
+		{ID: 1, Title: "Mail", Host: "mail.example.com"},
+		{ID: 2, Title: "Docs", Host: "docs.example.org"},
+		{ID: 3, Title: "Bank", Host: "bank.test"},
+	}
+	cfg := config.Default()
+	cfg.ExcludedHosts = []string{"*.example.com", "bank.test"}
+
+	got := filterTabs(tabs, cfg)
+	if len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("filterTabs() = %+v, want only tab 2", got)
+	}
+}
+
+func TestListTabsTemplate(t *testing.T) {
+	tabs := []protocol.Tab{{ID: 1, Title: "Fish & Chips", Host: "example.com"}}
+	cfg := config.Default().List
+	cfg.Template = "{{.ID}} {{.Title | pango}}"
+
+	var buf bytes.Buffer
+	if err := listTabs(&buf, tabs, registry.Instance{PID: 7}, false, cfg, rowImages{}, time.Now); err != nil {
+		t.Fatalf("listTabs() error = %v", err)
+	}
+	if got, want := buf.String(), "1 Fish &amp; Chips\n"; got != want {
+		t.Errorf("listTabs() output = %q, want %q", got, want)
+	}
+
+	cfg.Template = "{{.Nope"
+	if err := listTabs(&buf, tabs, registry.Instance{PID: 7}, false, cfg, rowImages{}, time.Now); err == nil {
+		t.Error("listTabs() expected error for invalid template")
+	}
+}
+
+// runCommand executes cmd against st and returns what was written to the
+// client connection.
+func runCommand(t *testing.T, cfg config.Config, st state, cmd protocol.Command) (string, error) {
+	t.Helper()
+	h := &host{cfg: cfg, pid: 1, out: nativemsg.NewWriter(io.Discard), now: time.Now, logger: slog.Default(), metrics: metrics.New()}
+	h.publish(&st)
+	return runHostCommand(t, h, cmd)
+}
+
+// runHostCommand executes cmd on h and returns what it wrote back.
+func runHostCommand(t *testing.T, h *host, cmd protocol.Command) (string, error) {
+	t.Helper()
+	server, client := net.Pipe()
+	defer client.Close()
+
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(client)
+		out <- data
+	}()
+
+	err := h.executeCommand(cmd, server)
+	server.Close()
+	return string(<-out), err
+}
+
+func TestExecuteLogLevelCommand(t *testing.T) {
+	defer logging.SetLevel("off")
+	cfg := config.Default()
+
+	if got, err := runCommand(t, cfg, state{}, protocol.LogLevelCommand{Level: "warn"}); err != nil || got != "warn\n" {
+		t.Errorf("loglevel warn = %q, %v", got, err)
+	}
+	if got, err := runCommand(t, cfg, state{}, protocol.LogLevelCommand{}); err != nil || got != "warn\n" {
+		t.Errorf("loglevel = %q, %v", got, err)
+	}
+	if _, err := runCommand(t, cfg, state{}, protocol.LogLevelCommand{Level: "loud"}); err == nil {
+		t.Error("loglevel loud expected error")
+	}
+}
+
+func TestExecuteStatsCommand(t *testing.T) {
+	h := &host{cfg: config.Default(), out: nativemsg.NewWriter(io.Discard), logger: slog.Default(), metrics: metrics.New()}
+	h.metrics.EventReceived("updated")
+
+	got, err := runHostCommand(t, h, protocol.StatsCommand{})
+	if err != nil {
+		t.Fatalf("stats error = %v", err)
+	}
+	var s metrics.Snapshot
+	if err := json.Unmarshal([]byte(got), &s); err != nil {
+		t.Fatalf("stats output is not JSON: %v\n%s", err, got)
+	}
+	if s.Events["updated"] != 1 {
+		t.Errorf("stats events = %v, want updated counted", s.Events)
+	}
+}
+
+func TestExecuteStatsCommandPlaying(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy.RedactedHosts = []string{"bank.test"}
+	st := state{tabs: []protocol.Tab{
+		{ID: 1, Title: "Song", Host: "music.test", Audible: true, LastAccessed: 1},
+		{ID: 2, Title: "Ad", Host: "news.test", Audible: true, Muted: true, LastAccessed: 3},
+		{ID: 3, Title: "Balance", Host: "bank.test", Audible: true, LastAccessed: 2},
+		{ID: 4, Title: "Docs", Host: "docs.test"},
+	}}
+	got, err := runCommand(t, cfg, st, protocol.StatsCommand{})
+	if err != nil {
+		t.Fatalf("stats error = %v", err)
+	}
+	var s stats
+	if err := json.Unmarshal([]byte(got), &s); err != nil {
+		t.Fatalf("stats output is not JSON: %v\n%s", err, got)
+	}
+	want := []playing{{ID: 3, Title: "[redacted]", Host: "[redacted]"}, {ID: 1, Title: "Song", Host: "music.test"}}
+	if len(s.Playing) != 2 || s.Playing[0] != want[0] || s.Playing[1] != want[1] {
+		t.Errorf("stats playing = %+v, want %+v", s.Playing, want)
+	}
+}
+
+func TestListTabsProfileFilterAndFields(t *testing.T) {
+	st := state{
+		tabs:    []protocol.Tab{{ID: 1, Title: "Inbox", Host: "mail.example.com"}},
+		browser: browser.Info{Product: "Chrome", ProfileDir: "Profile 1", ProfileName: "Work"},
+	}
+	cfg := config.Default()
+
+	got, err := runCommand(t, cfg, st, protocol.ListCommand{Template: "{{.Browser}}/{{.Profile}} {{.Title}}", Profile: "work"})
+	if err != nil || got != "Chrome/Work Inbox\n" {
+		t.Errorf("list --profile work = %q, %v", got, err)
+	}
+	got, err = runCommand(t, cfg, st, protocol.ListCommand{Profile: "Profile 1", Browser: "chrome"})
+	if err != nil || got != "1,1,mail.example.com,Inbox\n" {
+		t.Errorf("list --profile 'Profile 1' = %q, %v", got, err)
+	}
+	got, err = runCommand(t, cfg, st, protocol.ListCommand{Profile: "Personal"})
+	if err != nil || got != "" {
+		t.Errorf("list --profile Personal = %q, %v", got, err)
+	}
+}
+
+func TestListIncognitoAndRedaction(t *testing.T) {
+	st := state{tabs: []protocol.Tab{
+		{ID: 1, Title: "News", Host: "news.example.com"},
+		{ID: 2, Title: "Secret", Host: "shop.example.com", Incognito: true},
+		{ID: 3, Title: "Balance", Host: "online.bank.test"},
+	}}
+	cfg := config.Default()
+	cfg.Privacy.RedactedHosts = []string{"*.bank.test"}
+
+	tests := []struct {
+		mode string
+		want string
+	}{
+		{"", "1,1,news.example.com,News\n1,2,shop.example.com,Secret\n1,3,[redacted],[redacted]\n"},
+		{"exclude", "1,1,news.example.com,News\n1,3,[redacted],[redacted]\n"},
+		{"only", "1,2,shop.example.com,Secret\n"},
+	}
+	for _, tt := range tests {
+		got, err := runCommand(t, cfg, st, protocol.ListCommand{Incognito: tt.mode})
+		if err != nil || got != tt.want {
+			t.Errorf("list --incognito=%s = %q, %v; want %q", tt.mode, got, err, tt.want)
+		}
+	}
+
+	cfg.List.Incognito = "exclude"
+	got, _ := runCommand(t, cfg, st, protocol.ListCommand{})
+	if strings.Contains(got, "Secret") {
+		t.Errorf("list with list.incognito=exclude = %q", got)
+	}
+}
+
+func TestMPRISPlayersRedacted(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy = config.PrivacyConfig{Enabled: true, RedactedHosts: []string{"bank.test"}}
+	cfg.ExcludedHosts = []string{"radio.test"}
+	tabs := []protocol.Tab{
+		{ID: 1, Title: "Song", Host: "music.test", URL: "https://music.test/", Audible: true, LastAccessed: 3},
+		{ID: 2, Title: "Private", Host: "video.test", URL: "https://video.test/", Audible: true, Incognito: true, LastAccessed: 2},
+		{ID: 3, Title: "Balance", Host: "bank.test", Audible: true, Muted: true, LastAccessed: 1},
+		{ID: 4, Title: "Docs", Host: "docs.test"},
+		{ID: 5, Title: "Live", Host: "radio.test", URL: "https://radio.test/", Audible: true, LastAccessed: 4},
+	}
+	players := mprisPlayers(tabs, cfg)
+
+	want := []mpris.Player{
+		{TabID: 1, Title: "Song", Host: "music.test", URL: "https://music.test/"},
+		{TabID: 2, Title: "[redacted]", Host: "[redacted]"},
+		{TabID: 3, Title: "[redacted]", Host: "[redacted]", Muted: true},
+	}
+	if len(players) != len(want) {
+		t.Fatalf("mprisPlayers() = %+v", players)
+	}
+	for i := range want {
+		if players[i] != want[i] {
+			t.Errorf("player %d = %+v, want %+v", i, players[i], want[i])
+		}
+	}
+
+	cfg.List.Incognito = "exclude"
+	if players := mprisPlayers(tabs, cfg); len(players) != 2 || players[0].TabID != 1 || players[1].TabID != 3 {
+		t.Errorf("mprisPlayers() without incognito tabs = %+v", players)
+	}
+}
+
+func TestClosedTabsLeaveOutPrivateTabs(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExcludedHosts = []string{"bank.test"}
+	normal := protocol.Tab{ID: 1, Title: "News", Host: "news.test", URL: "https://news.test/", WindowID: 1}
+	private := protocol.Tab{ID: 2, Title: "Gift", Host: "shop.test", URL: "https://shop.test/gift", WindowID: 2, Incognito: true}
+	bank := protocol.Tab{ID: 3, Title: "Bank", Host: "bank.test", URL: "https://bank.test/", WindowID: 1}
+
+	h := &host{cfg: cfg, out: nativemsg.NewWriter(io.Discard), now: time.Now, logger: slog.Default(), metrics: metrics.New()}
+	h.publish(&state{closed: closedtabs.New(10)})
+	for _, tabs := range [][]protocol.Tab{{bank, private, normal}, nil} {
+		if err := h.handleEvent(protocol.UpdatedEvent{Tabs: tabs}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e, ok := h.state().closed.Get(1); h.state().closed.Len() != 1 || !ok || e.Tab.ID != normal.ID {
+		t.Errorf("journal = %+v", h.state().closed.Entries())
+	}
+
+	// Entries recorded anyway are filtered like list, and a private tab is
+	// not reopened once its incognito window is gone
+	all := closedtabs.New(10).Update([]protocol.Tab{bank, private, normal}, nil, time.Now(), func(protocol.Tab) bool { return true })
+	cfg.List.Incognito = "exclude"
+	if got, _ := runCommand(t, cfg, state{closed: all}, protocol.ClosedCommand{}); got != "3,just now,news.test,News\n" {
+		t.Errorf("closed = %q", got)
+	}
+	if got, _ := runCommand(t, cfg, state{closed: all}, protocol.ReopenCommand{N: 2}); !strings.HasPrefix(got, "no closed tab 2") {
+		t.Errorf("reopen excluded incognito tab = %q", got)
+	}
+	cfg.List.Incognito = "include"
+	if got, _ := runCommand(t, cfg, state{closed: all}, protocol.ReopenCommand{N: 2}); !strings.Contains(got, "incognito window is gone") {
+		t.Errorf("reopen private tab = %q", got)
+	}
+}
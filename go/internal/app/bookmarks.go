@@ -0,0 +1,69 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+
+	"rofi-chrome-tab/internal/listfmt"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// bookmarks lists the bookmarks, leaving out those on excluded or redacted
+// hosts.
+func (h *host) bookmarks(conn net.Conn, st *state) error {
+	var shown []protocol.Bookmark
+	for _, b := range st.bookmarks {
+		if !h.hidden(b.URL) {
+			shown = append(shown, b)
+		}
+	}
+	return listBookmarks(conn, shown, h.cfg.List.Format)
+}
+
+// listBookmarks writes one row per bookmark: its ID for open-bookmark, its
+// folder, its title and its URL.
+func listBookmarks(w io.Writer, bookmarks []protocol.Bookmark, format string) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for _, b := range bookmarks {
+		fmt.Fprintf(writer, "%s%s%s%s%s%s%s\n", b.ID,
+			sep, listfmt.Sanitize(b.Path),
+			sep, listfmt.Sanitize(b.Title),
+			sep, listfmt.Sanitize(b.URL))
+	}
+	return writer.Flush()
+}
+
+// openBookmark switches to a tab already showing the bookmark, or else asks
+// the extension to open it in the current window.
+func (h *host) openBookmark(conn net.Conn, st *state, id string) error {
+	var b *protocol.Bookmark
+	for i := range st.bookmarks {
+		if st.bookmarks[i].ID == id && !h.hidden(st.bookmarks[i].URL) {
+			b = &st.bookmarks[i]
+			break
+		}
+	}
+	if b == nil {
+		err := fmt.Errorf("no bookmark %s", id)
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	return h.openURL(conn, st, b.URL)
+}
+
+// bookmark asks the extension to bookmark an open tab.
+func (h *host) bookmark(conn net.Conn, st *state, c protocol.BookmarkCommand) error {
+	if _, ok := findTab(st.tabs, c.TabID); !ok {
+		err := fmt.Errorf("no tab %d", c.TabID)
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	if err := h.sendAction(st.ext, protocol.BookmarkAction(c)); err != nil {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+var errUnsupported = errors.New("action not supported by the extension")
+
+// legacyActions are assumed for extensions that connect without a hello.
+var legacyActions = []string{"select"}
+
+// extension is what the host knows about the connected extension.
+type extension struct {
+	hello *protocol.HelloEvent
+}
+
+// accepted reports whether the extension speaks a protocol the host can use.
+func (e extension) accepted() bool {
+	return e.hello == nil || e.hello.ProtocolVersion >= protocol.MinVersion
+}
+
+func (e extension) actions() []string {
+	if e.hello == nil {
+		return legacyActions
+	}
+	return e.hello.Actions
+}
+
+// supports returns an error unless the extension can perform action.
+func (e extension) supports(action string) error {
+	if !e.accepted() {
+		return fmt.Errorf("extension protocol %d is older than %d", e.hello.ProtocolVersion, protocol.MinVersion)
+	}
+	if !slices.Contains(e.actions(), action) {
+		return fmt.Errorf("%w: %s", errUnsupported, action)
+	}
+	return nil
+}
+
+func (e extension) version() string {
+	if e.hello == nil {
+		return "unknown"
+	}
+	return e.hello.ExtensionVersion
+}
+
+// describe returns a one-line summary of the extension for version output.
+func (e extension) describe() string {
+	if e.hello == nil {
+		return "unknown (no handshake)"
+	}
+	return fmt.Sprintf("%s (protocol %d, actions: %s)",
+		e.hello.ExtensionVersion, e.hello.ProtocolVersion, strings.Join(e.hello.Actions, " "))
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/nativemsg"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+func TestHandleHelloEvent(t *testing.T) {
+	var buf bytes.Buffer
+	h := &host{out: nativemsg.NewWriter(&buf), logger: slog.Default(), metrics: metrics.New()}
+	hello := protocol.HelloEvent{ProtocolVersion: 1, ExtensionVersion: "1.1", Actions: []string{"select"}}
+
+	if err := h.handleEvent(hello); err != nil {
+		t.Fatalf("handleEvent() error = %v", err)
+	}
+	st := h.state()
+	if st.ext.hello == nil || st.ext.hello.ExtensionVersion != "1.1" {
+		t.Fatalf("extension not recorded: %+v", st.ext)
+	}
+
+	var reply map[string]any
+	if err := nativemsg.NewReader(&buf, 0).Decode(&reply); err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if reply["command"] != "hello" || reply["protocolVersion"] != float64(protocol.Version) || reply["accepted"] != true {
+		t.Errorf("unexpected hello reply: %v", reply)
+	}
+}
+
+func TestExtensionSupports(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     extension
+		action  string
+		wantErr bool
+	}{
+		{"legacy select", extension{}, "select", false},
+		{"legacy unknown", extension{}, "reopen", true},
+		{"announced", extension{hello: &protocol.HelloEvent{ProtocolVersion: 1, Actions: []string{"select", "reopen"}}}, "reopen", false},
+		{"not announced", extension{hello: &protocol.HelloEvent{ProtocolVersion: 1, Actions: []string{"reopen"}}}, "select", true},
+		{"too old", extension{hello: &protocol.HelloEvent{ProtocolVersion: 0, Actions: []string{"select"}}}, "select", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.ext.supports(tt.action)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("supports(%q) error = %v, wantErr %v", tt.action, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSendActionRefusesUnsupported(t *testing.T) {
+	var buf bytes.Buffer
+	ext := extension{hello: &protocol.HelloEvent{ProtocolVersion: 1}}
+
+	h := &host{out: nativemsg.NewWriter(&buf), metrics: metrics.New()}
+	err := h.sendAction(ext, protocol.SelectAction{TabID: 1})
+	if !errors.Is(err, errUnsupported) {
+		t.Errorf("sendAction() error = %v, want errUnsupported", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("sendAction() wrote %d bytes for a refused action", buf.Len())
+	}
+}
+
+func TestExecuteVersionAndPing(t *testing.T) {
+	st := state{ext: extension{hello: &protocol.HelloEvent{ProtocolVersion: 1, ExtensionVersion: "1.1", Actions: []string{"select"}}}}
+
+	got, err := runCommand(t, config.Default(), st, protocol.VersionCommand{})
+	if err != nil {
+		t.Fatalf("version error = %v", err)
+	}
+	if !strings.Contains(got, "protocol: 1\n") || !strings.Contains(got, "extension: 1.1 (protocol 1, actions: select)\n") {
+		t.Errorf("version output = %q", got)
+	}
+
+	got, err = runCommand(t, config.Default(), st, protocol.PingCommand{})
+	if err != nil {
+		t.Fatalf("ping error = %v", err)
+	}
+	if !strings.HasPrefix(got, "pong ") || !strings.Contains(got, "extension=1.1") {
+		t.Errorf("ping output = %q", got)
+	}
+}
+
+func TestDroppedEventMarksStaleWithoutResync(t *testing.T) {
+	var buf bytes.Buffer
+	h := &host{out: nativemsg.NewWriter(&buf), logger: slog.Default(), metrics: metrics.New()}
+	h.publish(&state{ext: extension{hello: &protocol.HelloEvent{ProtocolVersion: 1, Actions: []string{"select"}}}})
+
+	err := h.handleEvent(protocol.DroppedEvent{Reason: "too large"})
+	if !errors.Is(err, errUnsupported) {
+		t.Errorf("handleEvent() error = %v, want errUnsupported", err)
+	}
+	if !h.state().stale {
+		t.Error("state not marked stale")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("resync sent to an extension that did not announce it")
+	}
+}
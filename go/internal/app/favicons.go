@@ -0,0 +1,60 @@
+package app
+
+import (
+	"path/filepath"
+
+	"rofi-chrome-tab/internal/favicon"
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// favicons returns the cache of site icons in the cache directory.
+func (h *host) favicons() (favicon.Cache, error) {
+	dir, err := h.cfg.CachePath()
+	if err != nil {
+		return favicon.Cache{}, err
+	}
+	return favicon.Cache{Dir: filepath.Join(dir, "favicons")}, nil
+}
+
+// storeFavicon caches the icon of a host, unless the host is never listed or
+// nothing about it may be stored.
+func (h *host) storeFavicon(e protocol.FaviconEvent) {
+	tab := protocol.Tab{Host: e.Host, Incognito: e.Incognito}
+	if h.cfg.IsExcluded(e.Host) || !privacy.New(h.cfg.Privacy).Persistable(tab) {
+		return
+	}
+	cache, err := h.favicons()
+	if err != nil {
+		h.logger.Warn("cannot cache favicon", "err", err)
+		return
+	}
+	if _, err := cache.Store(e.Host, e.Data); err != nil {
+		// Sites use formats the cache cannot convert, such as SVG
+		h.logger.Debug("cannot cache favicon", "host", e.Host, "err", err)
+		return
+	}
+	h.logger.Debug("favicon cached", "host", e.Host)
+}
+
+// rowImages finds the files of the images shown in list rows. Either
+// function may be nil.
+type rowImages struct {
+	icon      func(host string) string
+	thumbnail func(tabID int) string
+}
+
+// rowImages returns the cached icons and, if enabled, thumbnails for list
+// rows.
+func (h *host) rowImages() rowImages {
+	var images rowImages
+	if icons, err := h.favicons(); err == nil {
+		images.icon = icons.Lookup
+	}
+	if h.cfg.Thumbnails.Enabled {
+		if thumbs, err := h.thumbnails(); err == nil {
+			images.thumbnail = thumbs.Lookup
+		}
+	}
+	return images
+}
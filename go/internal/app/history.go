@@ -0,0 +1,92 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"time"
+
+	"rofi-chrome-tab/internal/focus"
+	"rofi-chrome-tab/internal/listfmt"
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// history searches the browser history through the extension. Pages on
+// excluded or redacted hosts are left out.
+func (h *host) history(conn net.Conn, st *state, c protocol.HistoryCommand) error {
+	var start float64
+	if c.Since > 0 {
+		start = float64(h.now().Add(-c.Since).UnixMilli())
+	}
+	var items []protocol.HistoryItem
+	err := h.request(st, func(id int) protocol.Action {
+		return protocol.HistoryAction{RequestID: id, Query: c.Query, StartTime: start, MaxResults: c.Limit}
+	}, &items)
+	if err != nil {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+
+	shown := items[:0]
+	for _, item := range items {
+		if !h.hidden(item.URL) {
+			shown = append(shown, item)
+		}
+	}
+	return listHistory(conn, shown, h.cfg.List.Format, h.now())
+}
+
+// hidden reports whether a page is on an excluded or redacted host.
+func (h *host) hidden(rawURL string) bool {
+	host := hostname(rawURL)
+	return h.cfg.IsExcluded(host) || privacy.New(h.cfg.Privacy).IsRedacted(protocol.Tab{Host: host})
+}
+
+// hostname returns the host of a URL, or "" if it has none.
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Hostname()
+}
+
+// listHistory writes one row per page: when it was last visited, how often,
+// its URL for the open command and its title.
+func listHistory(w io.Writer, items []protocol.HistoryItem, format string, now time.Time) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for _, item := range items {
+		fmt.Fprintf(writer, "%s%s%d%s%s%s%s\n", listfmt.RelTime(item.LastVisit(), now),
+			sep, item.VisitCount,
+			sep, listfmt.Sanitize(item.URL),
+			sep, listfmt.Sanitize(item.Title))
+	}
+	return writer.Flush()
+}
+
+// openURL switches to a tab already showing rawURL, or else asks the
+// extension to open it in the current window.
+func (h *host) openURL(conn net.Conn, st *state, rawURL string) error {
+	var a protocol.Action = protocol.OpenAction{Tabs: []protocol.OpenTab{{URL: rawURL}}}
+	if tab, ok := findTabByURL(st.tabs, rawURL); ok {
+		a = protocol.SelectAction{TabID: tab.ID}
+	}
+	if err := h.sendAction(st.ext, a); err != nil {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	return focus.Focus(h.cfg.FocusBackend)
+}
+
+func findTabByURL(tabs []protocol.Tab, rawURL string) (protocol.Tab, bool) {
+	for _, tab := range tabs {
+		if tab.URL == rawURL {
+			return tab, true
+		}
+	}
+	return protocol.Tab{}, false
+}
@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+
+	"rofi-chrome-tab/internal/launch"
+	"rofi-chrome-tab/internal/listfmt"
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// launchItems collects open tabs, closed tabs, bookmarks and, when the
+// extension can search it, history pages matching query. Pages on excluded or
+// redacted hosts are left out.
+func (h *host) launchItems(st *state, query string) []launch.Item {
+	var items []launch.Item
+	add := func(item launch.Item) {
+		if !h.hidden(item.URL) {
+			items = append(items, item)
+		}
+	}
+
+	tabs := privacy.FilterIncognito(filterTabs(st.tabs, h.cfg), h.cfg.List.Incognito)
+	policy := privacy.New(h.cfg.Privacy)
+	for _, tab := range tabs {
+		if policy.IsRedacted(tab) {
+			continue
+		}
+		add(launch.Item{Source: launch.Tab, Command: "select " + strconv.Itoa(tab.ID),
+			Title: tab.Title, URL: tab.URL, Time: tab.LastAccessedTime()})
+	}
+	for i, e := range st.closed.Entries() {
+		if !h.listable(e.Tab) {
+			continue
+		}
+		add(launch.Item{Source: launch.Closed, Command: "reopen " + strconv.Itoa(i+1),
+			Title: e.Tab.Title, URL: e.Tab.URL, Time: e.Closed})
+	}
+	for _, b := range st.bookmarks {
+		add(launch.Item{Source: launch.Bookmark, Command: "open-bookmark " + b.ID, Title: b.Title, URL: b.URL})
+	}
+
+	if st.ext.supports("history") == nil {
+		var pages []protocol.HistoryItem
+		err := h.request(st, func(id int) protocol.Action {
+			return protocol.HistoryAction{RequestID: id, Query: query, MaxResults: protocol.MaxHistoryResults}
+		}, &pages)
+		if err != nil {
+			// Launch without history rather than not at all
+			h.logger.Warn("cannot search history", "err", err)
+		}
+		for _, p := range pages {
+			add(launch.Item{Source: launch.History, Command: "open " + commandURL(p.URL),
+				Title: p.Title, URL: p.URL, Time: p.LastVisit(), Visits: p.VisitCount})
+		}
+	}
+	return items
+}
+
+// urlEscaper percent-encodes the characters of a URL that would be split or
+// unquoted by the command parser, or split a list row.
+var urlEscaper = strings.NewReplacer(",", "%2C", " ", "%20", "\t", "%09", `"`, "%22", "'", "%27", `\`, "%5C")
+
+// commandURL returns rawURL in a form that can be passed to the open command
+// as is.
+func commandURL(rawURL string) string {
+	return urlEscaper.Replace(listfmt.Sanitize(rawURL))
+}
+
+func (h *host) launch(conn net.Conn, st *state, c protocol.LaunchCommand) error {
+	items := launch.Rank(launch.Merge(h.launchItems(st, c.Query)), c.Query, h.now())
+	if len(items) > c.Limit {
+		items = items[:c.Limit]
+	}
+	return listLaunch(conn, items, h.cfg.List.Format)
+}
+
+// listLaunch writes one row per item: its source, the command that goes to
+// it, its host and its title.
+func listLaunch(w io.Writer, items []launch.Item, format string) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for _, item := range items {
+		title := item.Title
+		if title == "" {
+			title = item.URL
+		}
+		fmt.Fprintf(writer, "%s%s%s%s%s%s%s\n", item.Source,
+			sep, item.Command,
+			sep, listfmt.Sanitize(hostname(item.URL)),
+			sep, listfmt.Sanitize(title))
+	}
+	return writer.Flush()
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/focus"
+	"rofi-chrome-tab/internal/listfmt"
+	"rofi-chrome-tab/internal/mpris"
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// audibleTabs returns the tabs playing sound, muted or not, most recently
+// used first.
+func audibleTabs(tabs []protocol.Tab) []protocol.Tab {
+	var audible []protocol.Tab
+	for _, tab := range tabs {
+		if tab.Audible {
+			audible = append(audible, tab)
+		}
+	}
+	sort.SliceStable(audible, func(i, j int) bool { return audible[i].LastAccessed > audible[j].LastAccessed })
+	return audible
+}
+
+// playing is a tab that can be heard, as reported by stats.
+type playing struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+	Host  string `json:"host"`
+}
+
+// nowPlaying returns the audible, unmuted tabs, most recently used first,
+// with redacted hosts hidden.
+func nowPlaying(tabs []protocol.Tab, policy privacy.Policy) []playing {
+	out := []playing{}
+	for _, tab := range audibleTabs(tabs) {
+		if tab.Playing() {
+			tab = policy.Redact(tab)
+			out = append(out, playing{ID: tab.ID, Title: tab.Title, Host: tab.Host})
+		}
+	}
+	return out
+}
+
+func (h *host) media(conn net.Conn, st *state, c protocol.MediaCommand) error {
+	policy := privacy.New(h.cfg.Privacy)
+	tabs := privacy.FilterIncognito(filterTabs(st.tabs, h.cfg), h.cfg.List.Incognito)
+	reply := func(err error) error {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+
+	switch c.Action {
+	case "list":
+		return listMedia(conn, redactTabs(audibleTabs(tabs), policy), h.cfg.List.Format)
+	case "focus":
+		for _, tab := range audibleTabs(tabs) {
+			if tab.Playing() {
+				if err := h.sendAction(st.ext, protocol.SelectAction{TabID: tab.ID}); err != nil {
+					return reply(err)
+				}
+				return focus.Focus(h.cfg.FocusBackend)
+			}
+		}
+		return reply(errors.New("no tab is playing"))
+	case "mute-others":
+		keep := c.TabID
+		if audible := audibleTabs(tabs); keep == 0 && len(audible) > 0 {
+			keep = audible[0].ID
+		}
+		var mute []int
+		for _, tab := range tabs {
+			if tab.Playing() && tab.ID != keep {
+				mute = append(mute, tab.ID)
+			}
+		}
+		if len(mute) == 0 {
+			_, err := fmt.Fprintln(conn, "muted 0 tabs")
+			return err
+		}
+		if err := h.sendAction(st.ext, protocol.MuteAction{TabIDs: mute, Muted: true}); err != nil {
+			return reply(err)
+		}
+		_, err := fmt.Fprintf(conn, "muted %s\n", plural(len(mute), "tab"))
+		return err
+	case "toggle":
+		tab, ok := findTab(st.tabs, c.TabID)
+		if !ok {
+			return reply(fmt.Errorf("no tab %d", c.TabID))
+		}
+		if err := h.sendAction(st.ext, protocol.MuteAction{TabIDs: []int{tab.ID}, Muted: !tab.Muted}); err != nil {
+			return reply(err)
+		}
+		state := "muted"
+		if tab.Muted {
+			state = "unmuted"
+		}
+		_, err := fmt.Fprintf(conn, "%s %d\n", state, tab.ID)
+		return err
+	default:
+		return fmt.Errorf("unknown media action: %s", c.Action)
+	}
+}
+
+// listMedia writes one row per audible tab: its ID, whether it is playing or
+// muted, its host and its title.
+func listMedia(w io.Writer, tabs []protocol.Tab, format string) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for _, tab := range tabs {
+		state := "playing"
+		if tab.Muted {
+			state = "muted"
+		}
+		fmt.Fprintf(writer, "%d%s%s%s%s%s%s\n", tab.ID,
+			sep, state,
+			sep, listfmt.Sanitize(tab.Host),
+			sep, listfmt.Sanitize(tab.Title))
+	}
+	return writer.Flush()
+}
+
+// mprisPlayers describes the tabs playing sound, muted or not, for the MPRIS
+// bridge. Tabs are filtered as for list, since anything on the session bus
+// can read the players, and tabs that must not be recorded are shown
+// redacted.
+func mprisPlayers(tabs []protocol.Tab, cfg config.Config) []mpris.Player {
+	policy := privacy.New(cfg.Privacy)
+	tabs = privacy.FilterIncognito(filterTabs(tabs, cfg), cfg.List.Incognito)
+	var players []mpris.Player
+	for _, tab := range audibleTabs(tabs) {
+		p := mpris.Player{TabID: tab.ID, Title: tab.Title, Host: tab.Host, URL: tab.URL, Muted: tab.Muted}
+		if !policy.Persistable(tab) {
+			p.Title, p.Host, p.URL = privacy.Placeholder, privacy.Placeholder, ""
+		}
+		players = append(players, p)
+	}
+	return players
+}
+
+// mediaController carries out media player requests through the extension.
+type mediaController struct {
+	h *host
+}
+
+func (c mediaController) Mute(tabID int, muted bool) error {
+	return c.h.sendAction(c.h.state().ext, protocol.MuteAction{TabIDs: []int{tabID}, Muted: muted})
+}
+
+func (c mediaController) Raise(tabID int) error {
+	if err := c.h.sendAction(c.h.state().ext, protocol.SelectAction{TabID: tabID}); err != nil {
+		return err
+	}
+	return focus.Focus(c.h.cfg.FocusBackend)
+}
@@ -0,0 +1,141 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// maxChunked bounds the data sent in chunks for one request.
+const maxChunked = 64 << 20
+
+// reply is a response together with the data of the chunks sent before it.
+type reply struct {
+	protocol.ResponseEvent
+	data   []byte
+	chunks int
+	// err is set when the chunks could not be collected.
+	err error
+}
+
+// requests matches responses from the extension to the commands waiting for
+// them. The zero value is ready to use.
+type requests struct {
+	mu      sync.Mutex
+	next    int
+	waiting map[int]*pending
+}
+
+// pending is a request waiting for its response, collecting chunks.
+type pending struct {
+	ch     chan reply
+	data   []byte
+	chunks int
+	err    error
+}
+
+// add registers a new request and returns its ID and the channel its
+// response will be delivered on.
+func (r *requests) add() (int, <-chan reply) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.waiting == nil {
+		r.waiting = map[int]*pending{}
+	}
+	r.next++
+	p := &pending{ch: make(chan reply, 1)}
+	r.waiting[r.next] = p
+	return r.next, p.ch
+}
+
+func (r *requests) remove(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.waiting, id)
+}
+
+// chunk adds the data of e to its request. It reports false when nobody waits
+// for it any more.
+func (r *requests) chunk(e protocol.ChunkEvent) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.waiting[e.RequestID]
+	if !ok {
+		return false
+	}
+	p.chunks++
+	if p.err != nil {
+		return true
+	}
+	data, err := base64.StdEncoding.DecodeString(e.Data)
+	switch {
+	case err != nil:
+		p.err = fmt.Errorf("invalid chunk %d: %v", p.chunks, err)
+	case len(p.data)+len(data) > maxChunked:
+		p.err = fmt.Errorf("response larger than %d MB", maxChunked>>20)
+		p.data = nil
+	default:
+		p.data = append(p.data, data...)
+	}
+	return true
+}
+
+// resolve delivers e to its request. It reports false when nobody waits for
+// it any more, e.g. after a timeout.
+func (r *requests) resolve(e protocol.ResponseEvent) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.waiting[e.RequestID]
+	if ok {
+		delete(r.waiting, e.RequestID)
+		p.ch <- reply{ResponseEvent: e, data: p.data, chunks: p.chunks, err: p.err}
+	}
+	return ok
+}
+
+// errNoResponse is returned when the extension did not answer a request in
+// time.
+var errNoResponse = errors.New("no response from the extension")
+
+// request sends the action made by build for a new request ID and decodes
+// the extension's answer into result. It waits no longer than half the
+// command timeout, which also bounds the connection, leaving the rest for the
+// reply.
+func (h *host) request(st *state, build func(id int) protocol.Action, result any) error {
+	_, err := h.call(st, h.cfg.Commands.Timeout()/2, build, result)
+	return err
+}
+
+// call is request with a timeout of its own. It also returns the chunks that
+// came before the response.
+func (h *host) call(st *state, timeout time.Duration, build func(id int) protocol.Action, result any) (reply, error) {
+	id, ch := h.requests.add()
+	defer h.requests.remove(id)
+
+	a := build(id)
+	if err := h.sendAction(st.ext, a); err != nil {
+		return reply{}, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case resp := <-ch:
+		if resp.Error != "" {
+			return reply{}, errors.New(resp.Error)
+		}
+		if resp.err != nil {
+			return reply{}, resp.err
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return reply{}, fmt.Errorf("invalid response to %s: %v", a.Type(), err)
+		}
+		return resp, nil
+	case <-timer.C:
+		return reply{}, errNoResponse
+	}
+}
@@ -0,0 +1,848 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"rofi-chrome-tab/internal/browser"
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/nativemsg"
+	"rofi-chrome-tab/internal/protocol"
+	"rofi-chrome-tab/internal/registry"
+	"rofi-chrome-tab/internal/session"
+	"rofi-chrome-tab/internal/testharness"
+)
+
+// runningHost is a host started by startHost. exited is closed when Run
+// returns, after which err holds its result.
+type runningHost struct {
+	ext    *testharness.FakeExtension
+	client *testharness.Client
+	exited chan struct{}
+	err    error
+}
+
+// startHost runs a host against a fake extension, with sockets and data in
+// temporary directories. The host is stopped when the test ends.
+func startHost(t *testing.T, cfg config.Config, configure ...func(*Options)) *runningHost {
+	t.Helper()
+	cfg.SocketDir = t.TempDir()
+	cfg.FocusBackend = "none"
+	if cfg.DataDir == "" {
+		cfg.DataDir = t.TempDir()
+	}
+	if cfg.CacheDir == "" {
+		cfg.CacheDir = t.TempDir()
+	}
+
+	h := &runningHost{ext: testharness.NewFakeExtension(t), exited: make(chan struct{})}
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := Options{
+		Context: ctx,
+		Stdin:   h.ext.HostStdin,
+		Stdout:  h.ext.HostStdout,
+		Config:  cfg,
+		PID:     4242,
+		DetectBrowser: func() (browser.Info, error) {
+			return browser.Info{Product: "Chromium", ProfileDir: "Default", ProfileName: "Person 1"}, nil
+		},
+		Clock:   func() time.Time { return time.Unix(1700000000, 0) },
+		Logger:  slog.Default(),
+		Metrics: metrics.New(),
+	}
+	for _, f := range configure {
+		f(&opts)
+	}
+	go func() {
+		defer close(h.exited)
+		h.err = Run(opts)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-h.exited
+	})
+
+	h.client = testharness.NewClient(t, cfg.SocketPath(4242))
+	return h
+}
+
+func TestRunEndToEnd(t *testing.T) {
+	h := startHost(t, config.Default())
+	ext, client := h.ext, h.client
+
+	hello := ext.Hello("select")
+	if hello["accepted"] != true || hello["protocolVersion"] != float64(protocol.Version) {
+		t.Fatalf("unexpected hello reply: %v", hello)
+	}
+
+	ext.SendTabs(
+		protocol.Tab{ID: 1, Title: "Inbox", Host: "mail.example.com"},
+		protocol.Tab{ID: 2, Title: "Docs", Host: "docs.example.com"},
+	)
+	got := client.Eventually("list", func(r string) bool { return r != "" })
+	if want := "4242,1,mail.example.com,Inbox\n4242,2,docs.example.com,Docs\n"; got != want {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+
+	if _, err := client.Do("select 2"); err != nil {
+		t.Fatalf("select error = %v", err)
+	}
+	if action := ext.ExpectAction("select"); action["tabId"] != float64(2) {
+		t.Errorf("select action = %v", action)
+	}
+
+	got, err := client.Do("version")
+	if err != nil || !strings.Contains(got, "extension: test (protocol 1, actions: select)") || !strings.Contains(got, "browser: Chromium, profile Person 1 (Default)") {
+		t.Errorf("version = %q, %v", got, err)
+	}
+}
+
+func TestRunRefusesUnannouncedAction(t *testing.T) {
+	h := startHost(t, config.Default())
+	ext, client := h.ext, h.client
+	ext.Hello()
+
+	if _, err := client.Do("select 1"); err != nil {
+		t.Fatalf("select error = %v", err)
+	}
+	ext.ExpectNoAction(200 * time.Millisecond)
+}
+
+func TestRunRegistersAndCleansUp(t *testing.T) {
+	cfg := config.Default()
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	dir := strings.TrimSuffix(client.SocketPath, "/native-app.4242.sock")
+
+	instances, err := registry.List(dir)
+	if err != nil || len(instances) != 1 || instances[0].Browser.ProfileName != "Person 1" {
+		t.Fatalf("registry = %+v, %v", instances, err)
+	}
+
+	ext.Disconnect()
+	select {
+	case <-h.exited:
+		if h.err != nil {
+			t.Errorf("Run() error = %v", h.err)
+		}
+	case <-time.After(testharness.Timeout):
+		t.Fatal("host did not exit after the extension disconnected")
+	}
+	testharness.WaitGone(t, client.SocketPath)
+	if instances, _ := registry.List(dir); len(instances) != 0 {
+		t.Errorf("registry not cleaned up: %+v", instances)
+	}
+}
+
+func TestRunSlowClientDoesNotBlock(t *testing.T) {
+	cfg := config.Default()
+	cfg.Commands.TimeoutMS = 500
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select")
+
+	tabs := make([]protocol.Tab, 5000)
+	for i := range tabs {
+		tabs[i] = protocol.Tab{ID: i, Title: "Tab", Host: "example.com"}
+	}
+	ext.SendTabs(tabs...)
+	client.Eventually("list --template '{{.ID}}'", func(r string) bool { return strings.Count(r, "\n") == len(tabs) })
+
+	// Megabytes of rows the client never reads fill the socket buffer
+	stuck, err := net.Dial("unix", client.SocketPath)
+	if err != nil {
+		t.Fatalf("dial error = %v", err)
+	}
+	defer stuck.Close()
+	fmt.Fprintln(stuck, "list --template '{{.Title | pad 1000}}'")
+
+	start := time.Now()
+	if got, err := client.Do("ping"); err != nil || !strings.HasPrefix(got, "pong ") {
+		t.Errorf("ping during slow list = %q, %v", got, err)
+	}
+	ext.SendTabs(protocol.Tab{ID: 1, Title: "Only", Host: "example.com"})
+	client.Eventually("list", func(r string) bool { return r == "4242,1,example.com,Only\n" })
+	if d := time.Since(start); d > 400*time.Millisecond {
+		t.Errorf("host blocked for %v behind a slow client", d)
+	}
+
+	// The deadline cuts the slow client off well short of the full reply
+	time.Sleep(600 * time.Millisecond)
+	stuck.SetReadDeadline(time.Now().Add(testharness.Timeout))
+	data, _ := io.ReadAll(stuck)
+	if len(data) >= len(tabs)*1001 {
+		t.Errorf("slow client received the whole reply (%d bytes)", len(data))
+	}
+}
+
+func TestRunRecoversFromOversizedMessage(t *testing.T) {
+	h := startHost(t, config.Default())
+	ext, client := h.ext, h.client
+	ext.Hello("select", "resync")
+	ext.SendTabs(protocol.Tab{ID: 1, Title: "Old", Host: "example.com"})
+	client.Eventually("list", func(r string) bool { return r != "" })
+
+	ext.SendOversized(nativemsg.DefaultMaxIncoming + 1)
+	resync := ext.ExpectAction("resync")
+	if resync["maxMessageSize"] != float64(nativemsg.DefaultMaxIncoming) {
+		t.Errorf("resync action = %v", resync)
+	}
+	client.Eventually("list --template '{{.Stale}} {{.Title}}'", func(r string) bool { return r == "true Old\n" })
+	if got, _ := client.Do("stats"); !strings.Contains(got, `"stale": true`) {
+		t.Errorf("stats while stale = %s", got)
+	}
+
+	// A second drop while waiting for the resync does not ask again
+	ext.SendRaw([]byte("{corrupt"))
+	ext.ExpectNoAction(200 * time.Millisecond)
+
+	ext.SendTabs(protocol.Tab{ID: 2, Title: "New", Host: "example.com"})
+	client.Eventually("list --template '{{.Stale}} {{.Title}}'", func(r string) bool { return r == "false New\n" })
+	if got, _ := client.Do("stats"); !strings.Contains(got, `"stale": false`) {
+		t.Errorf("stats after resync = %s", got)
+	}
+}
+
+func TestRunClosedTabsAndReopen(t *testing.T) {
+	h := startHost(t, config.Default())
+	ext, client := h.ext, h.client
+	ext.Hello("select", "reopen")
+
+	mail := protocol.Tab{ID: 1, Title: "Inbox", Host: "mail.example.com", URL: "https://mail.example.com/", WindowID: 5, Index: 0}
+	docs := protocol.Tab{ID: 2, Title: "Docs", Host: "docs.example.com", URL: "https://docs.example.com/a", WindowID: 5, Index: 1, GroupID: 9}
+	news := protocol.Tab{ID: 3, Title: "News", Host: "news.example.com", URL: "https://news.example.com/", WindowID: 5, Index: 2}
+	ext.SendTabs(mail, docs, news)
+	ext.SendTabs(mail, news)
+	ext.SendTabs(mail)
+
+	got := client.Eventually("closed", func(r string) bool { return strings.Count(r, "\n") == 2 })
+	if want := "1,just now,news.example.com,News\n2,just now,docs.example.com,Docs\n"; got != want {
+		t.Errorf("closed = %q, want %q", got, want)
+	}
+
+	if _, err := client.Do("reopen 2"); err != nil {
+		t.Fatalf("reopen error = %v", err)
+	}
+	action := ext.ExpectAction("reopen")
+	if action["url"] != docs.URL || action["windowId"] != float64(5) || action["index"] != float64(1) || action["groupId"] != float64(9) {
+		t.Errorf("reopen action = %v", action)
+	}
+
+	// The browser brings the tab back under a new ID
+	ext.SendTabs(mail, protocol.Tab{ID: 4, Title: "Docs", Host: "docs.example.com", URL: docs.URL, WindowID: 5, Index: 1})
+	client.Eventually("closed", func(r string) bool { return r == "1,just now,news.example.com,News\n" })
+
+	if _, err := client.Do("undo"); err != nil {
+		t.Fatalf("undo error = %v", err)
+	}
+	if action := ext.ExpectAction("reopen"); action["url"] != news.URL {
+		t.Errorf("undo action = %v", action)
+	}
+
+	if got, _ := client.Do("reopen 5"); !strings.HasPrefix(got, "no closed tab 5") {
+		t.Errorf("reopen 5 = %q", got)
+	}
+}
+
+func TestRunSessions(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "open")
+
+	ext.Send(map[string]any{
+		"type": "updated",
+		"tabs": []protocol.Tab{
+			{ID: 1, Title: "Mail", Host: "mail.test", URL: "https://mail.test/", WindowID: 1, Index: 0, Pinned: true},
+			{ID: 2, Title: "Docs", Host: "docs.test", URL: "https://docs.test/", WindowID: 1, Index: 1, GroupID: 7},
+			{ID: 3, Title: "News", Host: "news.test", URL: "https://news.test/", WindowID: 2, Index: 0},
+		},
+		"groups": []protocol.Group{{ID: 7, WindowID: 1, Title: "Project", Color: "blue"}},
+	})
+	client.Eventually("list", func(r string) bool { return strings.Count(r, "\n") == 3 })
+
+	if got, _ := client.Do("session save work"); got != "saved work: 3 tabs in 2 windows\n" {
+		t.Errorf("session save = %q", got)
+	}
+	if got, _ := client.Do("session save --window 2 news"); got != "saved news: 1 tab in 1 window\n" {
+		t.Errorf("session save --window = %q", got)
+	}
+	got, _ := client.Do("session list")
+	if lines := strings.Split(got, "\n"); len(lines) != 3 || !strings.HasPrefix(lines[0], "news,") || !strings.HasSuffix(lines[1], ",2,3") {
+		t.Errorf("session list = %q", got)
+	}
+
+	if got, _ := client.Do("session restore work --new-window"); got != "restored work: 3 tabs in 2 windows\n" {
+		t.Errorf("session restore = %q", got)
+	}
+	first := ext.ExpectAction("open")
+	if first["newWindow"] != true || len(first["tabs"].([]any)) != 2 || len(first["groups"].([]any)) != 1 {
+		t.Errorf("first open action = %v", first)
+	}
+	if tab := first["tabs"].([]any)[1].(map[string]any); tab["url"] != "https://docs.test/" || tab["groupId"] != float64(7) {
+		t.Errorf("grouped tab = %v", tab)
+	}
+	if second := ext.ExpectAction("open"); len(second["tabs"].([]any)) != 1 {
+		t.Errorf("second open action = %v", second)
+	}
+
+	if got, _ := client.Do("session delete work"); got != "deleted work\n" {
+		t.Errorf("session delete = %q", got)
+	}
+	if got, _ := client.Do("session restore work"); !strings.Contains(got, "no such session") {
+		t.Errorf("session restore after delete = %q", got)
+	}
+	if got, _ := client.Do("session save ../x"); !strings.Contains(got, "invalid session name") {
+		t.Errorf("session save ../x = %q", got)
+	}
+}
+
+func TestRunSnapshotsOnShutdown(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "open")
+
+	ext.SendTabs(protocol.Tab{ID: 1, Title: "Research", Host: "papers.test", URL: "https://papers.test/1", WindowID: 1})
+	client.Eventually("list", func(r string) bool { return r != "" })
+	if got, _ := client.Do("snapshots"); got != "" {
+		t.Errorf("snapshots before shutdown = %q", got)
+	}
+
+	ext.Disconnect()
+	<-h.exited
+
+	profile := browser.Info{Product: "Chromium", ProfileDir: "Default", ProfileName: "Person 1"}
+	snapshots, err := session.Store{Dir: filepath.Join(cfg.DataDir, "snapshots", profile.Key())}.List()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("snapshots after shutdown = %+v, %v", snapshots, err)
+	}
+	if s := snapshots[0]; s.Name != "20231114T221320Z" || s.TabCount() != 1 || s.Windows[0].Tabs[0].URL != "https://papers.test/1" {
+		t.Errorf("snapshot = %+v", s)
+	}
+
+	// A new host offers it for restore
+	h = startHost(t, cfg)
+	h.ext.Hello("open")
+	if got, _ := h.client.Do("snapshots"); !strings.HasPrefix(got, "20231114T221320Z,") || !strings.HasSuffix(got, ",1,1\n") {
+		t.Errorf("snapshots = %q", got)
+	}
+	if got, _ := h.client.Do("snapshot restore 20231114T221320Z"); got != "restored 20231114T221320Z: 1 tab in 1 window\n" {
+		t.Errorf("snapshot restore = %q", got)
+	}
+	if action := h.ext.ExpectAction("open"); action["newWindow"] != nil {
+		t.Errorf("open action = %v", action)
+	}
+}
+
+func TestRunSnapshotsKeepProfileAfterHello(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	// The product is only known once the extension reports its brand
+	detected := browser.Info{UserDataDir: "/u/chrome", ProfileDir: "Default"}
+	detect := func(o *Options) {
+		o.DetectBrowser = func() (browser.Info, error) { return detected, nil }
+	}
+
+	h := startHost(t, cfg, detect)
+	h.ext.Send(map[string]any{"type": "hello", "protocolVersion": protocol.Version, "extensionVersion": "test",
+		"actions": []string{"select", "open"}, "browser": "Google Chrome"})
+	h.ext.ExpectAction("hello")
+	h.ext.SendTabs(protocol.Tab{ID: 1, URL: "https://papers.test/1", WindowID: 1})
+	h.client.Eventually("list", func(r string) bool { return r != "" })
+	h.ext.Disconnect()
+	<-h.exited
+
+	snapshots, err := session.Store{Dir: filepath.Join(cfg.DataDir, "snapshots", detected.Key())}.List()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("snapshots of %s = %+v, %v", detected, snapshots, err)
+	}
+
+	// The next host of the profile finds it before any hello
+	h = startHost(t, cfg, detect)
+	if got, _ := h.client.Do("snapshots"); !strings.HasSuffix(got, ",1,1\n") {
+		t.Errorf("snapshots = %q", got)
+	}
+}
+
+func TestRunExport(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy.RedactedHosts = []string{"bank.test"}
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select")
+
+	ext.Send(map[string]any{
+		"type": "updated",
+		"tabs": []protocol.Tab{
+			{ID: 1, Title: "Mail", Host: "mail.test", URL: "https://mail.test/", WindowID: 1, Index: 0},
+			{ID: 2, Title: "Docs", Host: "docs.test", URL: "https://docs.test/", WindowID: 1, Index: 1, GroupID: 7},
+			{ID: 3, Title: "Bank", Host: "bank.test", URL: "https://bank.test/", WindowID: 1, Index: 2, GroupID: 7},
+			{ID: 4, Title: "News", Host: "news.test", URL: "https://news.test/", WindowID: 2, Index: 0},
+		},
+		"groups": []protocol.Group{{ID: 7, WindowID: 1, Title: "Project"}},
+	})
+	client.Eventually("list", func(r string) bool { return strings.Count(r, "\n") == 4 })
+
+	if got, _ := client.Do("export --format=urls"); got != "https://mail.test/\nhttps://docs.test/\nhttps://news.test/\n" {
+		t.Errorf("export urls = %q", got)
+	}
+	if got, _ := client.Do("export --window 2"); got != "## Window 1\n\n- [News](https://news.test/)\n\n" {
+		t.Errorf("export --window = %q", got)
+	}
+	if got, _ := client.Do("export --group project --format onetab"); got != "https://docs.test/ | Docs\n" {
+		t.Errorf("export --group = %q", got)
+	}
+	if got, _ := client.Do("export --group Personal"); got != "no tab group \"Personal\"\n" {
+		t.Errorf("export unknown group = %q", got)
+	}
+	if got, _ := client.Do("export --window 9"); got != "no tabs to export\n" {
+		t.Errorf("export empty window = %q", got)
+	}
+}
+
+func TestRunBookmarks(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExcludedHosts = []string{"bank.test"}
+	cfg.Privacy.RedactedHosts = []string{"*.hr.test"}
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "open", "bookmark")
+
+	ext.SendTabs(protocol.Tab{ID: 4, Title: "Go", Host: "go.dev", URL: "https://go.dev/"})
+	ext.Send(map[string]any{
+		"type": "bookmarks",
+		"bookmarks": []protocol.Bookmark{
+			{ID: "10", Title: "Go", URL: "https://go.dev/", Path: "Bookmarks bar/Dev"},
+			{ID: "11", Title: "Rust", URL: "https://rust-lang.org/", Path: "Bookmarks bar/Dev"},
+			{ID: "12", Title: "Payslips", URL: "https://pay.hr.test/", Path: "Bookmarks bar"},
+			{ID: "13", Title: "Bank", URL: "https://bank.test/", Path: "Bookmarks bar"},
+		},
+	})
+	got := client.Eventually("bookmarks", func(r string) bool { return r != "" })
+	if want := "10,Bookmarks bar/Dev,Go,https://go.dev/\n11,Bookmarks bar/Dev,Rust,https://rust-lang.org/\n"; got != want {
+		t.Errorf("bookmarks = %q, want %q", got, want)
+	}
+
+	// An open tab wins over opening the bookmark again
+	client.Do("open-bookmark 10")
+	if action := ext.ExpectAction("select"); action["tabId"] != float64(4) {
+		t.Errorf("open-bookmark of an open page = %v", action)
+	}
+	client.Do("open-bookmark 11")
+	if action := ext.ExpectAction("open"); action["tabs"].([]any)[0].(map[string]any)["url"] != "https://rust-lang.org/" {
+		t.Errorf("open-bookmark = %v", action)
+	}
+	if got, _ := client.Do("open-bookmark 99"); got != "no bookmark 99\n" {
+		t.Errorf("open-bookmark unknown = %q", got)
+	}
+	if got, _ := client.Do("open-bookmark 12"); got != "no bookmark 12\n" {
+		t.Errorf("open-bookmark redacted = %q", got)
+	}
+
+	client.Do("bookmark --folder 'Bookmarks bar/Reading' 4")
+	if action := ext.ExpectAction("bookmark"); action["tabId"] != float64(4) || action["folder"] != "Bookmarks bar/Reading" {
+		t.Errorf("bookmark action = %v", action)
+	}
+	if got, _ := client.Do("bookmark 5"); got != "no tab 5\n" {
+		t.Errorf("bookmark unknown tab = %q", got)
+	}
+}
+
+func TestRunFavicons(t *testing.T) {
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Privacy.Enabled = true
+	cfg.Privacy.RedactedHosts = []string{"*.hr.test"}
+	cfg.List.Template = "{{.ID}}{{icon .Icon}}"
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select")
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+		t.Fatal(err)
+	}
+	icon := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	ext.SendTabs(
+		protocol.Tab{ID: 1, Host: "go.dev"},
+		protocol.Tab{ID: 2, Host: "private.test", Incognito: true},
+		protocol.Tab{ID: 3, Host: "pay.hr.test"},
+		protocol.Tab{ID: 4, Host: "vector.test"},
+	)
+	ext.Send(map[string]any{"type": "favicon", "host": "private.test", "incognito": true, "data": icon})
+	ext.Send(map[string]any{"type": "favicon", "host": "pay.hr.test", "data": icon})
+	ext.Send(map[string]any{"type": "favicon", "host": "vector.test", "data": "data:image/svg+xml,%3Csvg%2F%3E"})
+	ext.Send(map[string]any{"type": "favicon", "host": "go.dev", "data": icon})
+
+	dir := filepath.Join(cfg.CacheDir, "favicons")
+	want := "1\x00icon\x1f" + filepath.Join(dir, "go.dev.png") + "\n2\n3\n4\n"
+	if got := client.Eventually("list", func(r string) bool { return strings.Contains(r, "icon") }); got != want {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+	// Icons arrive in order, so the others were handled by now
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("cached icons = %v, want only go.dev", entries)
+	}
+}
+
+// sendChunks sends data base64 encoded in n chunks answering action, as the
+// extension does for large results.
+func sendChunks(ext *testharness.FakeExtension, action map[string]any, data []byte, n int) {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	size := ((len(encoded)+n-1)/n + 3) / 4 * 4
+	for i := 0; i < len(encoded); i += size {
+		ext.Send(map[string]any{"type": "chunk", "requestId": action["requestId"], "data": encoded[i:min(i+size, len(encoded))]})
+	}
+}
+
+func TestRunScreenshot(t *testing.T) {
+	cfg := config.Default()
+	cfg.Privacy.RedactedHosts = []string{"*.hr.test"}
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "screenshot")
+	ext.SendTabs(protocol.Tab{ID: 5, Host: "grafana.test"}, protocol.Tab{ID: 6, Host: "pay.hr.test"})
+	client.Eventually("list", func(r string) bool { return r != "" })
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	shot := buf.Bytes()
+
+	reply := make(chan string)
+	screenshot := func(line string) {
+		go func() {
+			got, _ := client.Do(line)
+			reply <- got
+		}()
+	}
+
+	// Without --out the image is the reply
+	screenshot("screenshot 5")
+	action := ext.ExpectAction("screenshot")
+	if action["tabId"] != float64(5) {
+		t.Errorf("screenshot action = %v", action)
+	}
+	sendChunks(ext, action, shot, 3)
+	ext.Respond(action, protocol.ScreenshotResult{Chunks: 3})
+	if got := <-reply; got != string(shot) {
+		t.Errorf("screenshot reply is %d bytes, want the %d byte PNG", len(got), len(shot))
+	}
+
+	out := filepath.Join(t.TempDir(), "shot.png")
+	screenshot("screenshot --out " + out + " 5")
+	action = ext.ExpectAction("screenshot")
+	sendChunks(ext, action, shot, 2)
+	ext.Respond(action, protocol.ScreenshotResult{Chunks: 2})
+	if got := <-reply; got != "saved "+out+"\n" {
+		t.Errorf("screenshot --out = %q", got)
+	}
+	if data, err := os.ReadFile(out); err != nil || !bytes.Equal(data, shot) {
+		t.Errorf("screenshot file: %d bytes, %v", len(data), err)
+	}
+
+	// A chunk went missing
+	screenshot("screenshot 5")
+	action = ext.ExpectAction("screenshot")
+	sendChunks(ext, action, shot, 1)
+	ext.Respond(action, protocol.ScreenshotResult{Chunks: 2})
+	if got := <-reply; got != "incomplete screenshot: got 1 of 2 chunks\n" {
+		t.Errorf("screenshot with a missing chunk = %q", got)
+	}
+
+	if got, _ := client.Do("screenshot 6"); got != "tab 6 is private\n" {
+		t.Errorf("screenshot of a redacted tab = %q", got)
+	}
+	if got, _ := client.Do("screenshot 9"); got != "no tab 9\n" {
+		t.Errorf("screenshot of an unknown tab = %q", got)
+	}
+}
+
+func TestRunThumbnails(t *testing.T) {
+	cfg := config.Default()
+	cfg.CacheDir = t.TempDir()
+	cfg.Thumbnails.Enabled = true
+	cfg.Privacy.RedactedHosts = []string{"*.hr.test"}
+	cfg.List.Template = "{{.ID}}{{icon .Thumbnail}}"
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	if hello := ext.Hello("select"); hello["thumbnails"] != true {
+		t.Errorf("hello = %v, want thumbnails requested", hello)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewNRGBA(image.Rect(0, 0, 320, 200))); err != nil {
+		t.Fatal(err)
+	}
+	thumb := "data:image/png;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	ext.SendTabs(protocol.Tab{ID: 5, Host: "grafana.test"}, protocol.Tab{ID: 6, Host: "pay.hr.test"})
+	ext.Send(map[string]any{"type": "thumbnail", "tabId": 6, "data": thumb})
+	ext.Send(map[string]any{"type": "thumbnail", "tabId": 5, "data": thumb})
+
+	dir := filepath.Join(cfg.CacheDir, "thumbnails", "4242")
+	want := "5\x00icon\x1f" + filepath.Join(dir, "5.png") + "\n6\n"
+	if got := client.Eventually("list", func(r string) bool { return strings.Contains(r, "icon") }); got != want {
+		t.Errorf("list = %q, want %q", got, want)
+	}
+
+	// Going to a redacted page drops the thumbnail
+	ext.SendTabs(protocol.Tab{ID: 5, Host: "wiki.hr.test"})
+	client.Eventually("list", func(r string) bool { return r == "5\n" })
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("thumbnails after redaction = %v", entries)
+	}
+
+	ext.SendTabs(protocol.Tab{ID: 5, Host: "grafana.test"})
+	ext.Send(map[string]any{"type": "thumbnail", "tabId": 5, "data": thumb})
+	client.Eventually("list", func(r string) bool { return strings.Contains(r, "icon") })
+	ext.Disconnect()
+	<-h.exited
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("thumbnails left after shutdown: %v", err)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExcludedHosts = []string{"bank.test"}
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "open", "history")
+	ext.SendTabs(protocol.Tab{ID: 4, Title: "Go", Host: "go.dev", URL: "https://go.dev/"})
+	client.Eventually("list", func(r string) bool { return r != "" })
+
+	reply := make(chan string)
+	go func() {
+		got, _ := client.Do("history go --since 7d --limit 10")
+		reply <- got
+	}()
+	action := ext.ExpectAction("history")
+	// The fixed clock is 2023-11-14T22:13:20Z
+	if action["query"] != "go" || action["maxResults"] != float64(10) || action["startTime"] != float64(1699395200000) {
+		t.Errorf("history action = %v", action)
+	}
+	ext.Respond(action, []protocol.HistoryItem{
+		{URL: "https://go.dev/doc/", Title: "Documentation", VisitCount: 3, LastVisitTime: 1699999800000},
+		{URL: "https://bank.test/go", Title: "Bank", VisitCount: 1, LastVisitTime: 1699999800000},
+	})
+	if got := <-reply; got != "3m ago,3,https://go.dev/doc/,Documentation\n" {
+		t.Errorf("history = %q", got)
+	}
+
+	go func() {
+		got, _ := client.Do("history nothing")
+		reply <- got
+	}()
+	action = ext.ExpectAction("history")
+	ext.Send(map[string]any{"type": "response", "requestId": action["requestId"], "error": "history is disabled"})
+	if got := <-reply; got != "history is disabled\n" {
+		t.Errorf("history error = %q", got)
+	}
+
+	client.Do("open https://go.dev/")
+	if action := ext.ExpectAction("select"); action["tabId"] != float64(4) {
+		t.Errorf("open of an open page = %v", action)
+	}
+	client.Do("open https://go.dev/doc/")
+	if action := ext.ExpectAction("open"); action["tabs"].([]any)[0].(map[string]any)["url"] != "https://go.dev/doc/" {
+		t.Errorf("open = %v", action)
+	}
+}
+
+func TestRunHistoryTimeout(t *testing.T) {
+	cfg := config.Default()
+	cfg.Commands.TimeoutMS = 200
+	h := startHost(t, cfg)
+	h.ext.Hello("history")
+
+	if got, _ := h.client.Do("history go"); got != "no response from the extension\n" {
+		t.Errorf("history without response = %q", got)
+	}
+	// A late response is ignored
+	h.ext.Respond(h.ext.ExpectAction("history"), []protocol.HistoryItem{})
+	if got, _ := h.client.Do("ping"); !strings.HasPrefix(got, "pong") {
+		t.Errorf("ping after late response = %q", got)
+	}
+}
+
+func TestRunLaunch(t *testing.T) {
+	h := startHost(t, config.Default())
+	ext, client := h.ext, h.client
+	ext.Hello("select", "open", "history", "reopen")
+
+	// 2023-11-14T22:13:20Z is the fixed clock
+	now := float64(1700000000000)
+	ext.SendTabs(
+		protocol.Tab{ID: 1, Title: "Go Playground", Host: "go.dev", URL: "https://go.dev/play/", LastAccessed: now},
+		protocol.Tab{ID: 2, Title: "Go blog", Host: "go.dev", URL: "https://go.dev/blog/", LastAccessed: now},
+	)
+	ext.SendTabs(protocol.Tab{ID: 1, Title: "Go Playground", Host: "go.dev", URL: "https://go.dev/play/", LastAccessed: now})
+	ext.Send(map[string]any{
+		"type":      "bookmarks",
+		"bookmarks": []protocol.Bookmark{{ID: "7", Title: "Go Playground", URL: "https://go.dev/play/"}},
+	})
+	client.Eventually("closed", func(r string) bool { return r != "" })
+
+	reply := make(chan string)
+	go func() {
+		got, _ := client.Do("launch go")
+		reply <- got
+	}()
+	action := ext.ExpectAction("history")
+	if action["query"] != "go" {
+		t.Errorf("history action = %v", action)
+	}
+	ext.Respond(action, []protocol.HistoryItem{
+		{URL: "https://go.dev/play/", Title: "Go Playground", VisitCount: 20, LastVisitTime: now},
+		{URL: "https://pkg.go.dev/search?q=a,b", Title: "Packages", VisitCount: 1, LastVisitTime: now - 86400000},
+	})
+	want := "tab,select 1,go.dev,Go Playground\n" +
+		"closed,reopen 1,go.dev,Go blog\n" +
+		"history,open https://pkg.go.dev/search?q=a%2Cb,pkg.go.dev,Packages\n"
+	if got := <-reply; got != want {
+		t.Errorf("launch = %q, want %q", got, want)
+	}
+
+	// The history entry's command works as is
+	client.Do("open https://pkg.go.dev/search?q=a%2Cb")
+	ext.ExpectAction("open")
+}
+
+func TestRunMedia(t *testing.T) {
+	cfg := config.Default()
+	cfg.ExcludedHosts = []string{"radio.test"}
+	h := startHost(t, cfg)
+	ext, client := h.ext, h.client
+	ext.Hello("select", "mute")
+
+	ext.SendTabs(
+		protocol.Tab{ID: 1, Title: "Song", Host: "music.test", Audible: true, LastAccessed: 1},
+		protocol.Tab{ID: 2, Title: "Ad", Host: "news.test", Audible: true, Muted: true, LastAccessed: 2},
+		protocol.Tab{ID: 3, Title: "Autoplay", Host: "video.test", Audible: true, LastAccessed: 3},
+		protocol.Tab{ID: 4, Title: "Docs", Host: "docs.test", LastAccessed: 4},
+		protocol.Tab{ID: 5, Title: "Live", Host: "radio.test", Audible: true, LastAccessed: 0.5},
+	)
+	got := client.Eventually("media list", func(r string) bool { return r != "" })
+	if want := "3,playing,video.test,Autoplay\n2,muted,news.test,Ad\n1,playing,music.test,Song\n"; got != want {
+		t.Errorf("media list = %q, want %q", got, want)
+	}
+
+	client.Do("media focus")
+	if action := ext.ExpectAction("select"); action["tabId"] != float64(3) {
+		t.Errorf("media focus = %v", action)
+	}
+
+	if got, _ := client.Do("media mute-others 1"); got != "muted 1 tab\n" {
+		t.Errorf("media mute-others = %q", got)
+	}
+	if action := ext.ExpectAction("mute"); fmt.Sprint(action["tabIds"]) != "[3]" || action["muted"] != true {
+		t.Errorf("mute action = %v", action)
+	}
+	// Without a tab, the most recently used audible one keeps playing, not
+	// the silent tab in front; tabs on excluded hosts are left alone
+	if got, _ := client.Do("media mute-others"); got != "muted 1 tab\n" {
+		t.Errorf("media mute-others = %q", got)
+	}
+	if action := ext.ExpectAction("mute"); fmt.Sprint(action["tabIds"]) != "[1]" {
+		t.Errorf("mute action = %v", action)
+	}
+
+	if got, _ := client.Do("media toggle 2"); got != "unmuted 2\n" {
+		t.Errorf("media toggle = %q", got)
+	}
+	if action := ext.ExpectAction("mute"); fmt.Sprint(action["tabIds"]) != "[2]" || action["muted"] != false {
+		t.Errorf("mute action = %v", action)
+	}
+	if got, _ := client.Do("media toggle 9"); got != "no tab 9\n" {
+		t.Errorf("media toggle unknown = %q", got)
+	}
+}
+
+func TestRunMPRIS(t *testing.T) {
+	addr := testharness.StartBus(t)
+	bus, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+
+	cfg := config.Default()
+	cfg.MPRIS = true
+	h := startHost(t, cfg, func(o *Options) {
+		o.ConnectBus = func() (*dbus.Conn, error) { return dbus.Connect(addr) }
+	})
+	ext := h.ext
+	ext.Hello("select", "mute")
+	ext.SendTabs(protocol.Tab{ID: 5, Title: "Song", Host: "music.test", URL: "https://music.test/", Audible: true})
+
+	name := "org.mpris.MediaPlayer2.rofi_chrome_tab.instance4242_tab5"
+	player := bus.Object(name, "/org/mpris/MediaPlayer2")
+	deadline := time.Now().Add(testharness.Timeout)
+	for {
+		v, err := player.GetProperty("org.mpris.MediaPlayer2.Identity")
+		if err == nil {
+			if v.Value() != "Chromium" {
+				t.Errorf("Identity = %v", v)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no media player on the bus: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := player.Call("org.mpris.MediaPlayer2.Player.Pause", 0).Err; err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	if action := ext.ExpectAction("mute"); fmt.Sprint(action["tabIds"]) != "[5]" || action["muted"] != true {
+		t.Errorf("mute action = %v", action)
+	}
+	if err := player.Call("org.mpris.MediaPlayer2.Raise", 0).Err; err != nil {
+		t.Fatalf("Raise: %v", err)
+	}
+	if action := ext.ExpectAction("select"); action["tabId"] != float64(5) {
+		t.Errorf("select action = %v", action)
+	}
+
+	// The player goes away with the sound
+	ext.SendTabs(protocol.Tab{ID: 5, Title: "Song", Host: "music.test", URL: "https://music.test/"})
+	deadline = time.Now().Add(testharness.Timeout)
+	for {
+		var names []string
+		if err := bus.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Contains(names, name) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("media player still on the bus")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
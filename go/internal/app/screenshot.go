@@ -0,0 +1,116 @@
+package app
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+	"rofi-chrome-tab/internal/thumbnail"
+)
+
+// screenshotTimeout bounds the wait for a screenshot: switching to the tab,
+// capturing it and sending a large image takes longer than other requests.
+const screenshotTimeout = 15 * time.Second
+
+// screenshot has the extension capture a tab and writes the PNG to c.Out, or
+// else to conn. Tabs that may not be stored are refused.
+func (h *host) screenshot(conn net.Conn, st *state, c protocol.ScreenshotCommand) error {
+	reply := func(err error) error {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	tab, ok := findTab(st.tabs, c.TabID)
+	if !ok {
+		return reply(fmt.Errorf("no tab %d", c.TabID))
+	}
+	if h.cfg.IsExcluded(tab.Host) || !privacy.New(h.cfg.Privacy).Persistable(tab) {
+		return reply(fmt.Errorf("tab %d is private", c.TabID))
+	}
+
+	// Leave the usual time for writing the reply once the image is in
+	conn.SetDeadline(time.Now().Add(screenshotTimeout + h.cfg.Commands.Timeout()))
+	var result protocol.ScreenshotResult
+	resp, err := h.call(st, screenshotTimeout, func(id int) protocol.Action {
+		return protocol.ScreenshotAction{RequestID: id, TabID: c.TabID}
+	}, &result)
+	if err != nil {
+		return reply(err)
+	}
+	if resp.chunks != result.Chunks {
+		return reply(fmt.Errorf("incomplete screenshot: got %d of %d chunks", resp.chunks, result.Chunks))
+	}
+	if _, err := png.DecodeConfig(bytes.NewReader(resp.data)); err != nil {
+		return reply(fmt.Errorf("invalid screenshot: %v", err))
+	}
+
+	if c.Out == "" {
+		_, err := conn.Write(resp.data)
+		return err
+	}
+	if err := os.WriteFile(c.Out, resp.data, 0600); err != nil {
+		return reply(err)
+	}
+	_, err = fmt.Fprintf(conn, "saved %s\n", c.Out)
+	return err
+}
+
+// thumbnails returns the thumbnail cache of this host. Tab IDs only mean
+// something within one browser session, so each host has its own.
+func (h *host) thumbnails() (thumbnail.Cache, error) {
+	dir, err := h.cfg.CachePath()
+	if err != nil {
+		return thumbnail.Cache{}, err
+	}
+	return thumbnail.Cache{
+		Dir:  filepath.Join(dir, "thumbnails", strconv.Itoa(h.pid)),
+		Keep: h.cfg.Thumbnails.Keep,
+	}, nil
+}
+
+// storeThumbnail keeps the thumbnail of an open tab that may be stored.
+func (h *host) storeThumbnail(st *state, e protocol.ThumbnailEvent) {
+	if !h.cfg.Thumbnails.Enabled {
+		return
+	}
+	tab, ok := findTab(st.tabs, e.TabID)
+	if !ok || h.cfg.IsExcluded(tab.Host) || !privacy.New(h.cfg.Privacy).Persistable(tab) {
+		return
+	}
+	cache, err := h.thumbnails()
+	if err != nil {
+		h.logger.Warn("cannot cache thumbnail", "err", err)
+		return
+	}
+	open := func(id int) bool {
+		_, ok := findTab(st.tabs, id)
+		return ok
+	}
+	if _, err := cache.Store(e.TabID, e.Data, open); err != nil {
+		h.logger.Warn("cannot cache thumbnail", "tab", e.TabID, "err", err)
+	}
+}
+
+// dropThumbnails removes the thumbnails of tabs that went to a page that may
+// not be stored.
+func (h *host) dropThumbnails(tabs []protocol.Tab) {
+	if !h.cfg.Thumbnails.Enabled {
+		return
+	}
+	cache, err := h.thumbnails()
+	if err != nil {
+		return
+	}
+	policy := privacy.New(h.cfg.Privacy)
+	for _, tab := range tabs {
+		if h.cfg.IsExcluded(tab.Host) || !policy.Persistable(tab) {
+			cache.Remove(tab.ID)
+		}
+	}
+}
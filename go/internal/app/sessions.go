@@ -0,0 +1,206 @@
+package app
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"rofi-chrome-tab/internal/focus"
+	"rofi-chrome-tab/internal/privacy"
+	"rofi-chrome-tab/internal/protocol"
+	"rofi-chrome-tab/internal/session"
+)
+
+// store returns the session store in the kind subdirectory of the data
+// directory: "sessions" or "snapshots".
+func (h *host) store(kind string) (session.Store, error) {
+	dir, err := h.cfg.DataPath()
+	if err != nil {
+		return session.Store{}, err
+	}
+	return session.Store{Dir: filepath.Join(dir, kind)}, nil
+}
+
+// snapshotStore returns the snapshot store of the browser profile of the
+// host. Snapshots are kept per profile so that hosts of several browsers
+// neither prune nor restore each other's.
+func (h *host) snapshotStore() (session.Store, error) {
+	store, err := h.store("snapshots")
+	if err != nil {
+		return session.Store{}, err
+	}
+	store.Dir = filepath.Join(store.Dir, h.snapshotKey)
+	return store, nil
+}
+
+func (h *host) session(conn net.Conn, st *state, c protocol.SessionCommand) error {
+	store, err := h.store("sessions")
+	if err != nil {
+		return err
+	}
+
+	reply := func(err error) error {
+		fmt.Fprintln(conn, err)
+		return err
+	}
+	switch c.Action {
+	case "save":
+		s := session.Build(c.Session, h.now(), st.tabs, st.groups, c.WindowID, privacy.New(h.cfg.Privacy).Persistable)
+		if s.TabCount() == 0 {
+			return reply(errors.New("no tabs to save"))
+		}
+		if err := store.Save(s); err != nil {
+			return reply(err)
+		}
+		_, err := fmt.Fprintf(conn, "saved %s: %s\n", s.Name, describeSession(s))
+		return err
+	case "list":
+		sessions, err := store.List()
+		if err != nil {
+			return reply(err)
+		}
+		return listSessions(conn, sessions, h.cfg.List.Format)
+	case "restore":
+		s, err := store.Load(c.Session)
+		if err != nil {
+			return reply(err)
+		}
+		return h.restore(conn, st, s, c.NewWindow)
+	case "delete":
+		if err := store.Delete(c.Session); err != nil {
+			return reply(err)
+		}
+		_, err := fmt.Fprintf(conn, "deleted %s\n", c.Session)
+		return err
+	default:
+		return fmt.Errorf("unknown session action: %s", c.Action)
+	}
+}
+
+func describeSession(s session.Session) string {
+	return plural(s.TabCount(), "tab") + " in " + plural(len(s.Windows), "window")
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// openAction asks the extension to open the tabs of a saved window.
+func openAction(w session.Window, newWindow bool) protocol.OpenAction {
+	a := protocol.OpenAction{NewWindow: newWindow}
+	for _, t := range w.Tabs {
+		a.Tabs = append(a.Tabs, protocol.OpenTab{URL: t.URL, Pinned: t.Pinned, GroupID: t.GroupID})
+	}
+	for _, g := range w.Groups {
+		a.Groups = append(a.Groups, protocol.Group{ID: g.ID, Title: g.Title, Color: g.Color, Collapsed: g.Collapsed})
+	}
+	return a
+}
+
+// restore opens the windows of s through the extension.
+func (h *host) restore(conn net.Conn, st *state, s session.Session, newWindow bool) error {
+	for _, w := range s.Windows {
+		if err := h.sendAction(st.ext, openAction(w, newWindow)); err != nil {
+			fmt.Fprintln(conn, err)
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(conn, "restored %s: %s\n", s.Name, describeSession(s)); err != nil {
+		return err
+	}
+	return focus.Focus(h.cfg.FocusBackend)
+}
+
+// listSessions writes one row per session: its name, when it was saved and
+// how many windows and tabs it has.
+func listSessions(w io.Writer, sessions []session.Session, format string) error {
+	sep := listSeparator(format)
+	writer := bufio.NewWriter(w)
+	for _, s := range sessions {
+		fmt.Fprintf(writer, "%s%s%s%s%d%s%d\n", s.Name,
+			sep, s.Saved.Local().Format("2006-01-02 15:04"),
+			sep, len(s.Windows),
+			sep, s.TabCount())
+	}
+	return writer.Flush()
+}
+
+func (h *host) snapshots(conn net.Conn, st *state, cmd protocol.Command) error {
+	store, err := h.snapshotStore()
+	if err != nil {
+		return err
+	}
+	switch c := cmd.(type) {
+	case protocol.SnapshotsCommand:
+		snapshots, err := store.List()
+		if err != nil {
+			fmt.Fprintln(conn, err)
+			return err
+		}
+		return listSessions(conn, snapshots, h.cfg.List.Format)
+	case protocol.SnapshotRestoreCommand:
+		s, err := store.Load(c.Timestamp)
+		if err != nil {
+			fmt.Fprintln(conn, err)
+			return err
+		}
+		return h.restore(conn, st, s, c.NewWindow)
+	default:
+		return fmt.Errorf("unknown snapshot command: %T", cmd)
+	}
+}
+
+// snapshotter writes the open tabs to the snapshot store, skipping
+// snapshots identical to the previous one. It is not safe for concurrent
+// use.
+type snapshotter struct {
+	h    *host
+	last []session.Window
+}
+
+// take writes a snapshot of the current state, keeping the configured number
+// of generations.
+func (sn *snapshotter) take() error {
+	h := sn.h
+	st := h.state()
+	now := h.now()
+	s := session.Build(session.SnapshotName(now), now, st.tabs, st.groups, 0, privacy.New(h.cfg.Privacy).Persistable)
+	if s.TabCount() == 0 || reflect.DeepEqual(s.Windows, sn.last) {
+		return nil
+	}
+
+	store, err := h.snapshotStore()
+	if err != nil {
+		return err
+	}
+	if err := store.Save(s); err != nil {
+		return err
+	}
+	sn.last = s.Windows
+	h.logger.Debug("snapshot saved", "name", s.Name, "tabs", s.TabCount())
+	return store.Prune(h.cfg.Snapshots.Keep)
+}
+
+// run takes a snapshot every interval until done is closed.
+func (sn *snapshotter) run(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := sn.take(); err != nil {
+				sn.h.logger.Error("cannot save snapshot", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package app
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/browser"
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/nativemsg"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+func TestSnapshotterSkipsUnchangedAndPrunes(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Snapshots.Keep = 2
+	cfg.Privacy.RedactedHosts = []string{"*.bank.test"}
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	h := &host{cfg: cfg, out: nativemsg.NewWriter(io.Discard), logger: slog.Default(), metrics: metrics.New(),
+		now: func() time.Time { now = now.Add(time.Minute); return now }}
+	sn := &snapshotter{h: h}
+	store, err := h.snapshotStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := sn.take(); err != nil {
+		t.Fatalf("take() with no tabs error = %v", err)
+	}
+	if list, _ := store.List(); len(list) != 0 {
+		t.Fatalf("snapshot saved with no tabs: %+v", list)
+	}
+
+	a := protocol.Tab{ID: 1, URL: "https://a.test/", WindowID: 1}
+	bank := protocol.Tab{ID: 2, Host: "online.bank.test", URL: "https://online.bank.test/", WindowID: 1, Index: 1}
+	c := protocol.Tab{ID: 3, URL: "https://c.test/", WindowID: 2}
+	private := protocol.Tab{ID: 4, URL: "https://gift.test/", WindowID: 3, Incognito: true}
+	// The redacted and incognito tabs are never stored, even without privacy
+	// mode, so the second state is the same as the first and does not make a
+	// new generation
+	for i, tabs := range [][]protocol.Tab{{a}, {a, bank, private}, {a, c}, {c}} {
+		h.publish(&state{tabs: tabs})
+		for range 2 {
+			if err := sn.take(); err != nil {
+				t.Fatalf("take() error = %v", err)
+			}
+		}
+		if list, _ := store.List(); i == 1 && len(list) != 1 {
+			t.Fatalf("unchanged tabs made %d snapshots", len(list))
+		}
+	}
+
+	list, err := store.List()
+	if err != nil || len(list) != 2 {
+		t.Fatalf("snapshots = %+v, %v", list, err)
+	}
+	if len(list[0].Windows) != 2 || list[1].TabCount() != 1 || list[1].Windows[0].Tabs[0].URL != c.URL {
+		t.Errorf("snapshots = %+v", list)
+	}
+}
+
+func TestSnapshotsArePerProfile(t *testing.T) {
+	cfg := config.Default()
+	cfg.DataDir = t.TempDir()
+	cfg.Snapshots.Keep = 1
+
+	// Both hosts snapshot in the same second, so their snapshots have the
+	// same name
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	newHost := func(profile browser.Info, url string) (*host, *snapshotter) {
+		h := &host{cfg: cfg, out: nativemsg.NewWriter(io.Discard), logger: slog.Default(), metrics: metrics.New(),
+			now: func() time.Time { return now }, snapshotKey: profile.Key()}
+		h.publish(&state{browser: profile, tabs: []protocol.Tab{{ID: 1, URL: url, WindowID: 1}}})
+		return h, &snapshotter{h: h}
+	}
+	work, workSnap := newHost(browser.Info{Product: "Chrome", UserDataDir: "/u/chrome", ProfileDir: "Profile 1"}, "https://work.test/")
+	home, homeSnap := newHost(browser.Info{Product: "Chrome", UserDataDir: "/u/chrome", ProfileDir: "Default"}, "https://home.test/")
+	for _, sn := range []*snapshotter{workSnap, homeSnap} {
+		if err := sn.take(); err != nil {
+			t.Fatalf("take() error = %v", err)
+		}
+	}
+
+	for h, want := range map[*host]string{work: "https://work.test/", home: "https://home.test/"} {
+		store, err := h.snapshotStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		list, err := store.List()
+		if err != nil || len(list) != 1 {
+			t.Fatalf("snapshots of %s = %+v, %v", h.state().browser, list, err)
+		}
+		if got := list[0].Windows[0].Tabs[0].URL; got != want {
+			t.Errorf("snapshot of %s has %s, want %s", h.state().browser, got, want)
+		}
+	}
+}
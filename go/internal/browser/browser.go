@@ -0,0 +1,247 @@
+package browser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Info identifies the browser and profile a host instance serves.
+type Info struct {
+	Product     string `json:"product,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+	UserDataDir string `json:"userDataDir,omitempty"`
+	ProfileDir  string `json:"profileDir,omitempty"`
+	ProfileName string `json:"profileName,omitempty"`
+}
+
+// Profile returns the most readable name of the profile.
+func (i Info) Profile() string {
+	if i.ProfileName != "" {
+		return i.ProfileName
+	}
+	return i.ProfileDir
+}
+
+func (i Info) String() string {
+	if i.Product == "" {
+		return "unknown"
+	}
+	s := i.Product
+	if i.Channel != "" && i.Channel != "stable" {
+		s += " " + i.Channel
+	}
+	if p := i.Profile(); p != "" {
+		s += ", profile " + p
+		if i.ProfileName != "" && i.ProfileDir != "" {
+			s += " (" + i.ProfileDir + ")"
+		}
+	}
+	return s
+}
+
+var unsafeKey = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Key returns a name that tells the profiles of all browsers apart and is
+// usable as a file name: the product and profile directory for reading,
+// followed by a hash of everything that identifies the profile.
+func (i Info) Key() string {
+	name := i.Product
+	if name == "" {
+		name = "unknown"
+	}
+	if i.ProfileDir != "" {
+		name += "-" + i.ProfileDir
+	}
+	h := fnv.New32a()
+	for _, s := range []string{i.Product, i.Channel, i.UserDataDir, i.ProfileDir} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%s-%08x", unsafeKey.ReplaceAllString(name, "_"), h.Sum32())
+}
+
+// Merge fills the fields of i that are empty from other.
+func (i Info) Merge(other Info) Info {
+	if i.Product == "" {
+		i.Product = other.Product
+	}
+	if i.Channel == "" {
+		i.Channel = other.Channel
+	}
+	if i.UserDataDir == "" {
+		i.UserDataDir = other.UserDataDir
+	}
+	if i.ProfileDir == "" {
+		i.ProfileDir = other.ProfileDir
+	}
+	if i.ProfileName == "" {
+		i.ProfileName = other.ProfileName
+	}
+	return i
+}
+
+type product struct {
+	name string
+	// executable name fragments and the channel they imply, most specific first
+	markers []struct{ marker, channel string }
+	// user data directories relative to $XDG_CONFIG_HOME, by channel
+	dataDirs map[string]string
+}
+
+func markers(pairs ...string) []struct{ marker, channel string } {
+	var m []struct{ marker, channel string }
+	for i := 0; i < len(pairs); i += 2 {
+		m = append(m, struct{ marker, channel string }{pairs[i], pairs[i+1]})
+	}
+	return m
+}
+
+var products = []product{
+	{
+		name:    "Chrome",
+		markers: markers("chrome-beta", "beta", "chrome-unstable", "dev", "google-chrome", "stable", "/opt/google/chrome/", "stable"),
+		dataDirs: map[string]string{
+			"stable": "google-chrome",
+			"beta":   "google-chrome-beta",
+			"dev":    "google-chrome-unstable",
+		},
+	},
+	{
+		name:     "Brave",
+		markers:  markers("brave-browser-beta", "beta", "brave-browser-nightly", "nightly", "brave", "stable"),
+		dataDirs: map[string]string{"stable": "BraveSoftware/Brave-Browser", "beta": "BraveSoftware/Brave-Browser-Beta", "nightly": "BraveSoftware/Brave-Browser-Nightly"},
+	},
+	{
+		name:     "Edge",
+		markers:  markers("msedge-beta", "beta", "microsoft-edge-beta", "beta", "msedge-dev", "dev", "microsoft-edge-dev", "dev", "msedge", "stable", "microsoft-edge", "stable"),
+		dataDirs: map[string]string{"stable": "microsoft-edge", "beta": "microsoft-edge-beta", "dev": "microsoft-edge-dev"},
+	},
+	{
+		name:     "Vivaldi",
+		markers:  markers("vivaldi-snapshot", "snapshot", "vivaldi", "stable"),
+		dataDirs: map[string]string{"stable": "vivaldi", "snapshot": "vivaldi-snapshot"},
+	},
+	{
+		name:     "Chromium",
+		markers:  markers("chromium", "stable"),
+		dataDirs: map[string]string{"stable": "chromium"},
+	},
+}
+
+// ParseCommandLine identifies the browser from its argv.
+func ParseCommandLine(args []string) Info {
+	var info Info
+	if len(args) == 0 {
+		return info
+	}
+
+	exe := strings.ToLower(args[0])
+	var prod *product
+	for i := range products {
+		for _, m := range products[i].markers {
+			if strings.Contains(exe, m.marker) {
+				prod = &products[i]
+				info.Product = prod.name
+				info.Channel = m.channel
+				break
+			}
+		}
+		if prod != nil {
+			break
+		}
+	}
+
+	for _, arg := range args[1:] {
+		if v, ok := strings.CutPrefix(arg, "--user-data-dir="); ok {
+			info.UserDataDir = v
+		}
+		if v, ok := strings.CutPrefix(arg, "--profile-directory="); ok {
+			info.ProfileDir = v
+		}
+	}
+
+	if info.UserDataDir == "" && prod != nil {
+		if dir, ok := prod.dataDirs[info.Channel]; ok {
+			info.UserDataDir = filepath.Join(configHome(), dir)
+		}
+	}
+	return info
+}
+
+// FromBrand maps a brand reported by navigator.userAgentData to a product.
+func FromBrand(brand string) string {
+	b := strings.ToLower(brand)
+	switch {
+	case strings.Contains(b, "brave"):
+		return "Brave"
+	case strings.Contains(b, "edge"):
+		return "Edge"
+	case strings.Contains(b, "vivaldi"):
+		return "Vivaldi"
+	case strings.Contains(b, "google chrome"):
+		return "Chrome"
+	case strings.Contains(b, "chromium"):
+		return "Chromium"
+	}
+	return ""
+}
+
+// Detect identifies the browser that started this host by reading the
+// command line of process ppid under procRoot (normally /proc), then looks up
+// the name of the profile in the browser's Local State.
+//
+// The profile is only known when the browser was started with
+// --profile-directory. A browser serves all its profiles from one process,
+// and nothing tells which of them the extension runs in, so otherwise the
+// profile is left empty rather than guessed.
+func Detect(procRoot string, ppid int) (Info, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, fmt.Sprint(ppid), "cmdline"))
+	if err != nil {
+		return Info{}, err
+	}
+	args := strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	info := ParseCommandLine(args)
+	if info.UserDataDir != "" && info.ProfileDir != "" {
+		info = resolveProfile(info)
+	}
+	return info, nil
+}
+
+// resolveProfile fills in the profile name from the "Local State" file of the
+// user data directory.
+func resolveProfile(info Info) Info {
+	data, err := os.ReadFile(filepath.Join(info.UserDataDir, "Local State"))
+	if err != nil {
+		return info
+	}
+
+	var state struct {
+		Profile struct {
+			InfoCache map[string]struct {
+				Name string `json:"name"`
+			} `json:"info_cache"`
+		} `json:"profile"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&state); err != nil {
+		return info
+	}
+
+	if p, ok := state.Profile.InfoCache[info.ProfileDir]; ok {
+		info.ProfileName = p.Name
+	}
+	return info
+}
+
+func configHome() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config")
+}
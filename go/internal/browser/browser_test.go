@@ -0,0 +1,154 @@
+package browser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseCommandLine(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/home/u/.config")
+
+	tests := []struct {
+		name string
+		args []string
+		want Info
+	}{
+		{
+			"chrome stable",
+			[]string{"/opt/google/chrome/chrome"},
+			Info{Product: "Chrome", Channel: "stable", UserDataDir: "/home/u/.config/google-chrome"},
+		},
+		{
+			"chrome beta with profile",
+			[]string{"/opt/google/chrome-beta/chrome", "--profile-directory=Profile 1"},
+			Info{Product: "Chrome", Channel: "beta", UserDataDir: "/home/u/.config/google-chrome-beta", ProfileDir: "Profile 1"},
+		},
+		{
+			"chromium custom data dir",
+			[]string{"/usr/lib/chromium/chromium", "--user-data-dir=/tmp/work"},
+			Info{Product: "Chromium", Channel: "stable", UserDataDir: "/tmp/work"},
+		},
+		{
+			"brave",
+			[]string{"/opt/brave.com/brave/brave"},
+			Info{Product: "Brave", Channel: "stable", UserDataDir: "/home/u/.config/BraveSoftware/Brave-Browser"},
+		},
+		{
+			"edge dev",
+			[]string{"/opt/microsoft/msedge-dev/msedge"},
+			Info{Product: "Edge", Channel: "dev", UserDataDir: "/home/u/.config/microsoft-edge-dev"},
+		},
+		{
+			"vivaldi",
+			[]string{"/opt/vivaldi/vivaldi-bin"},
+			Info{Product: "Vivaldi", Channel: "stable", UserDataDir: "/home/u/.config/vivaldi"},
+		},
+		{
+			"unknown",
+			[]string{"/bin/bash"},
+			Info{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseCommandLine(tt.args); got != tt.want {
+				t.Errorf("ParseCommandLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "data")
+	if err := os.MkdirAll(filepath.Join(root, "proc", "42"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	cmdline := "/usr/lib/chromium/chromium\x00--user-data-dir=" + dataDir + "\x00"
+	if err := os.WriteFile(filepath.Join(root, "proc", "42", "cmdline"), []byte(cmdline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	localState := `{"profile": {"last_used": "Profile 2", "info_cache": {"Default": {"name": "Personal"}, "Profile 2": {"name": "Work"}}}}`
+	if err := os.WriteFile(filepath.Join(dataDir, "Local State"), []byte(localState), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without --profile-directory the last used profile may not be the one
+	// the host serves, so none is reported
+	got, err := Detect(filepath.Join(root, "proc"), 42)
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	want := Info{Product: "Chromium", Channel: "stable", UserDataDir: dataDir}
+	if got != want {
+		t.Errorf("Detect() = %+v, want %+v", got, want)
+	}
+	if got.String() != "Chromium" {
+		t.Errorf("String() = %q", got.String())
+	}
+
+	cmdline += "--profile-directory=Profile 2\x00"
+	if err := os.WriteFile(filepath.Join(root, "proc", "42", "cmdline"), []byte(cmdline), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err = Detect(filepath.Join(root, "proc"), 42)
+	if err != nil {
+		t.Fatalf("Detect() error = %v", err)
+	}
+	want = Info{Product: "Chromium", Channel: "stable", UserDataDir: dataDir, ProfileDir: "Profile 2", ProfileName: "Work"}
+	if got != want {
+		t.Errorf("Detect() with --profile-directory = %+v, want %+v", got, want)
+	}
+	if got.String() != "Chromium, profile Work (Profile 2)" {
+		t.Errorf("String() = %q", got.String())
+	}
+
+	if _, err := Detect(filepath.Join(root, "proc"), 43); err == nil {
+		t.Error("Detect() expected error for missing process")
+	}
+}
+
+func TestKey(t *testing.T) {
+	chrome := Info{Product: "Chrome", Channel: "stable", UserDataDir: "/home/u/.config/google-chrome", ProfileDir: "Profile 1"}
+	if got := chrome.Key(); !strings.HasPrefix(got, "Chrome-Profile_1-") || strings.ContainsAny(got, " /") {
+		t.Errorf("Key() = %q", got)
+	}
+	if got := (Info{}).Key(); !strings.HasPrefix(got, "unknown-") {
+		t.Errorf("Key() of unknown browser = %q", got)
+	}
+
+	other := chrome
+	other.UserDataDir = "/tmp/work"
+	beta := chrome
+	beta.Channel = "beta"
+	seen := map[string]bool{}
+	for _, i := range []Info{chrome, other, beta, {}} {
+		if seen[i.Key()] {
+			t.Errorf("Key() of %+v is not unique", i)
+		}
+		seen[i.Key()] = true
+	}
+	if chrome.Key() != chrome.Key() {
+		t.Error("Key() is not stable")
+	}
+}
+
+func TestFromBrand(t *testing.T) {
+	for brand, want := range map[string]string{
+		"Google Chrome":  "Chrome",
+		"Brave":          "Brave",
+		"Microsoft Edge": "Edge",
+		"Chromium":       "Chromium",
+		"Not_A Brand":    "",
+	} {
+		if got := FromBrand(brand); got != want {
+			t.Errorf("FromBrand(%q) = %q, want %q", brand, got, want)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Package closedtabs keeps a bounded journal of recently closed tabs so they
+// can be reopened. A Journal is immutable; every change returns a new one, so
+// it can live in the host's state snapshots.
+package closedtabs
+
+import (
+	"time"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// Entry is a closed tab. The tab keeps the window, index and group it had
+// when it was last seen.
+type Entry struct {
+	Tab    protocol.Tab
+	Closed time.Time
+}
+
+// Journal holds closed tabs, most recently closed first.
+type Journal struct {
+	entries []Entry
+	max     int
+}
+
+// New returns an empty journal keeping at most max entries.
+func New(max int) Journal {
+	return Journal{max: max}
+}
+
+// Entries returns the closed tabs, most recently closed first. The slice
+// must not be modified.
+func (j Journal) Entries() []Entry {
+	return j.entries
+}
+
+func (j Journal) Len() int {
+	return len(j.entries)
+}
+
+// Get returns the nth most recently closed tab, counting from 1.
+func (j Journal) Get(n int) (Entry, bool) {
+	if n < 1 || n > len(j.entries) {
+		return Entry{}, false
+	}
+	return j.entries[n-1], true
+}
+
+// Update compares the tabs before and after an update. A tab that
+// disappeared while one with the same URL appeared was replaced under a new
+// ID, as the browser does for prerendered and discarded tabs, and is not
+// closed. Other tabs that disappeared and satisfy keep are recorded as closed
+// at now; other tabs that appeared remove the newest entry with the same URL,
+// since that is most likely the tab coming back.
+func (j Journal) Update(before, after []protocol.Tab, now time.Time, keep func(protocol.Tab) bool) Journal {
+	if j.max <= 0 {
+		return j
+	}
+	beforeIDs := make(map[int]bool, len(before))
+	for _, tab := range before {
+		beforeIDs[tab.ID] = true
+	}
+	afterIDs := make(map[int]bool, len(after))
+	for _, tab := range after {
+		afterIDs[tab.ID] = true
+	}
+
+	appeared := map[string]int{}
+	for _, tab := range after {
+		if !beforeIDs[tab.ID] && tab.URL != "" {
+			appeared[tab.URL]++
+		}
+	}
+
+	// Tabs closed together keep their browser order
+	var closed []Entry
+	for _, tab := range before {
+		if afterIDs[tab.ID] || tab.URL == "" {
+			continue
+		}
+		if appeared[tab.URL] > 0 {
+			appeared[tab.URL]--
+			continue
+		}
+		if keep(tab) {
+			closed = append(closed, Entry{Tab: tab, Closed: now})
+		}
+	}
+
+	entries := append([]Entry(nil), j.entries...)
+	for url, n := range appeared {
+		for range n {
+			entries = removeURL(entries, url)
+		}
+	}
+
+	entries = append(closed, entries...)
+	if len(entries) > j.max {
+		entries = entries[:j.max]
+	}
+	return Journal{entries: entries, max: j.max}
+}
+
+func removeURL(entries []Entry, url string) []Entry {
+	for i, e := range entries {
+		if e.Tab.URL == url {
+			return append(entries[:i:i], entries[i+1:]...)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,109 @@
+package closedtabs
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+func tab(id int, url string) protocol.Tab {
+	return protocol.Tab{ID: id, Title: url, URL: url}
+}
+
+func keepAll(protocol.Tab) bool { return true }
+
+func urls(j Journal) []string {
+	var got []string
+	for _, e := range j.Entries() {
+		got = append(got, e.Tab.URL)
+	}
+	return got
+}
+
+func TestUpdateRecordsClosedTabs(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	a, b, c := tab(1, "https://a.test/"), tab(2, "https://b.test/"), tab(3, "https://c.test/")
+
+	j := New(10).Update(nil, []protocol.Tab{a, b, c}, now, keepAll)
+	if j.Len() != 0 {
+		t.Fatalf("journal after first update = %v", urls(j))
+	}
+
+	j = j.Update([]protocol.Tab{a, b, c}, []protocol.Tab{b}, now, keepAll)
+	if want := []string{"https://a.test/", "https://c.test/"}; !slices.Equal(urls(j), want) {
+		t.Errorf("journal = %v, want %v", urls(j), want)
+	}
+	if e, ok := j.Get(1); !ok || e.Tab.ID != 1 || !e.Closed.Equal(now) {
+		t.Errorf("Get(1) = %+v, %v", e, ok)
+	}
+	if _, ok := j.Get(3); ok {
+		t.Error("Get(3) found an entry")
+	}
+
+	later := now.Add(time.Minute)
+	j = j.Update([]protocol.Tab{b}, nil, later, keepAll)
+	if want := []string{"https://b.test/", "https://a.test/", "https://c.test/"}; !slices.Equal(urls(j), want) {
+		t.Errorf("journal = %v, want %v", urls(j), want)
+	}
+}
+
+func TestUpdateForgetsReopenedTabs(t *testing.T) {
+	now := time.Now()
+	a, b := tab(1, "https://a.test/"), tab(2, "https://b.test/")
+	j := New(10).Update([]protocol.Tab{a, b}, nil, now, keepAll)
+
+	// Reopened under a new ID
+	reopened := tab(7, "https://b.test/")
+	j = j.Update(nil, []protocol.Tab{reopened}, now, keepAll)
+	if want := []string{"https://a.test/"}; !slices.Equal(urls(j), want) {
+		t.Errorf("journal = %v, want %v", urls(j), want)
+	}
+}
+
+func TestUpdateIgnoresReplacedTabs(t *testing.T) {
+	now := time.Now()
+	a, b, c := tab(1, "https://a.test/"), tab(2, "https://b.test/"), tab(3, "https://c.test/")
+	j := New(10).Update([]protocol.Tab{a, b, c}, []protocol.Tab{b, c}, now, keepAll)
+
+	// b is replaced under a new ID, c is closed and another a.test tab opens:
+	// only c is journaled and the earlier a.test entry is forgotten
+	replaced := tab(8, "https://b.test/")
+	j = j.Update([]protocol.Tab{b, c}, []protocol.Tab{replaced, tab(9, "https://a.test/")}, now, keepAll)
+	if want := []string{"https://c.test/"}; !slices.Equal(urls(j), want) {
+		t.Errorf("journal = %v, want %v", urls(j), want)
+	}
+}
+
+func TestUpdateBoundAndFilter(t *testing.T) {
+	var before []protocol.Tab
+	for i := range 5 {
+		before = append(before, tab(i, "https://"+string(rune('a'+i))+".test/"))
+	}
+	before = append(before, protocol.Tab{ID: 9, Title: "New Tab"})
+
+	keep := func(t protocol.Tab) bool { return t.ID != 0 }
+	j := New(3).Update(before, nil, time.Now(), keep)
+	if want := []string{"https://b.test/", "https://c.test/", "https://d.test/"}; !slices.Equal(urls(j), want) {
+		t.Errorf("journal = %v, want %v", urls(j), want)
+	}
+
+	if j := New(0).Update(before, nil, time.Now(), keepAll); j.Len() != 0 {
+		t.Errorf("disabled journal recorded %d tabs", j.Len())
+	}
+}
+
+func TestUpdateDoesNotModifyEarlierJournal(t *testing.T) {
+	a, b := tab(1, "https://a.test/"), tab(2, "https://b.test/")
+	j1 := New(10).Update([]protocol.Tab{a}, nil, time.Now(), keepAll)
+	j2 := j1.Update([]protocol.Tab{b}, nil, time.Now(), keepAll)
+	_ = j2.Update(nil, []protocol.Tab{tab(3, "https://a.test/")}, time.Now(), keepAll)
+
+	if want := []string{"https://a.test/"}; !slices.Equal(urls(j1), want) {
+		t.Errorf("first journal changed to %v", urls(j1))
+	}
+	if want := []string{"https://b.test/", "https://a.test/"}; !slices.Equal(urls(j2), want) {
+		t.Errorf("second journal changed to %v", urls(j2))
+	}
+}
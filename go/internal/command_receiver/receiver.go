@@ -2,12 +2,17 @@ package command_receiver
 
 import (
 	"bufio"
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
+	"rofi-chrome-tab/internal/metrics"
 	"rofi-chrome-tab/internal/protocol"
 )
 
@@ -16,41 +21,91 @@ type CommandWithConn struct {
 	Conn net.Conn
 }
 
-func Start(pid int, debugMode bool, cmdCh chan<- CommandWithConn) string {
-	// Determine socket path based on process ID and debug mode
-	socketPath := "/tmp/native-app.sock"
-	if !debugMode {
-		socketPath = fmt.Sprintf("/tmp/native-app.%d.sock", pid)
-	}
+// Limits protect the host from slow or numerous clients.
+type Limits struct {
+	// Timeout is the deadline for reading the command and writing the
+	// reply, measured from accepting the connection; 0 means none.
+	Timeout time.Duration
+	// MaxConns is the number of connections open at once; 0 means no limit.
+	MaxConns int
+}
+
+// trackedConn reports its closing to the metrics registry and frees its
+// connection slot exactly once.
+type trackedConn struct {
+	net.Conn
+	once    sync.Once
+	reg     *metrics.Registry
+	release func()
+}
 
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		c.reg.ConnectionClosed()
+		c.release()
+	})
+	return c.Conn.Close()
+}
+
+// Start listens for commands on socketPath until ctx is done, logging to
+// logger and counting connections in reg. The receiver of cmdCh owns each
+// connection and must close it.
+func Start(ctx context.Context, socketPath string, limits Limits, cmdCh chan<- CommandWithConn, logger *slog.Logger, reg *metrics.Registry) error {
 	// Remove existing socket file
 	if err := os.RemoveAll(socketPath); err != nil {
-		log.Fatal(err)
+		return err
+	}
+
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	logger.Info("listening on socket", "path", socketPath)
+
+	go func() {
+		<-ctx.Done()
+		lis.Close()
+	}()
+
+	var slots chan struct{}
+	if limits.MaxConns > 0 {
+		slots = make(chan struct{}, limits.MaxConns)
 	}
 
 	// Receive commands from an Unix domain socket
 	go func() {
-		lis, err := net.Listen("unix", socketPath)
-		if err != nil {
-			log.Fatal("listen error:", err)
-		}
 		defer lis.Close()
 
-		log.Printf("Listening on socket: %s", socketPath)
-
 		for {
 			conn, err := lis.Accept()
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			if err != nil {
-				log.Println("Accept error:", err)
+				logger.Error("accept error", "err", err)
 				continue
 			}
 
+			release, ok := acquire(slots)
+			if !ok {
+				reg.ConnectionRejected()
+				logger.Warn("too many connections, refusing client", "max", limits.MaxConns)
+				conn.SetWriteDeadline(time.Now().Add(100 * time.Millisecond))
+				fmt.Fprintln(conn, "error: too many connections")
+				conn.Close()
+				continue
+			}
+			if limits.Timeout > 0 {
+				conn.SetDeadline(time.Now().Add(limits.Timeout))
+			}
+
+			reg.ConnectionOpened()
 			go func(c net.Conn) {
 				scanner := bufio.NewScanner(c)
 
 				scanner.Scan()
 				if err := scanner.Err(); err != nil {
-					log.Println("Read error:", err)
+					logger.Warn("read error", "err", err)
 					c.Close()
 					return
 				}
@@ -59,16 +114,35 @@ func Start(pid int, debugMode bool, cmdCh chan<- CommandWithConn) string {
 
 				cmd, err := protocol.ParseCommand(line)
 				if err != nil {
-					log.Println("Parse error:", err, "line:", line)
+					reg.ParseError("command")
+					logger.Warn("parse error", "err", err, "line", line)
 					c.Close()
 					return
 				}
-				log.Printf("Received command: %T", cmd)
+				logger.Debug("received command", "command", cmd.Name())
 
-				cmdCh <- CommandWithConn{Cmd: cmd, Conn: c}
-			}(conn)
+				select {
+				case cmdCh <- CommandWithConn{Cmd: cmd, Conn: c}:
+				case <-ctx.Done():
+					c.Close()
+				}
+			}(&trackedConn{Conn: conn, reg: reg, release: release})
 		}
 	}()
 
-	return socketPath
+	return nil
+}
+
+// acquire takes a slot without waiting, returning the function freeing it. A
+// nil slots channel never runs out.
+func acquire(slots chan struct{}) (release func(), ok bool) {
+	if slots == nil {
+		return func() {}, true
+	}
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, true
+	default:
+		return nil, false
+	}
 }
@@ -2,23 +2,27 @@ package command_receiver
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"net"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"rofi-chrome-tab/internal/metrics"
 	"rofi-chrome-tab/internal/protocol"
 )
 
 func TestStartCommandReceiver(t *testing.T) {
 	// Set up test environment
-	pid := 12345
-	debugMode := false
+	socketPath := filepath.Join(t.TempDir(), "native-app.12345.sock")
 	testCmdCh := make(chan CommandWithConn, 1)
 
 	// Start the command receiver
-	socketPath := Start(pid, debugMode, testCmdCh)
-	defer os.RemoveAll(socketPath)
+	if err := Start(t.Context(), socketPath, Limits{}, testCmdCh, slog.Default(), metrics.New()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
 
 	// Wait for socket to be ready with retry logic
 	if err := waitForSocket(socketPath, 2*time.Second); err != nil {
@@ -142,15 +146,18 @@ func waitForSocket(socketPath string, timeout time.Duration) error {
 	return fmt.Errorf("timeout waiting for socket %s", socketPath)
 }
 
-func TestStartCommandReceiverDebugMode(t *testing.T) {
-	// Set up test environment in debug mode
-	pid := 12345
-	debugMode := true
+func TestStartCommandReceiverReplacesStaleSocket(t *testing.T) {
+	// Leave a stale file where the socket should be created
+	socketPath := filepath.Join(t.TempDir(), "native-app.sock")
+	if err := os.WriteFile(socketPath, nil, 0600); err != nil {
+		t.Fatalf("Failed to create stale socket file: %v", err)
+	}
 	testCmdCh := make(chan CommandWithConn, 1)
 
 	// Start the command receiver
-	socketPath := Start(pid, debugMode, testCmdCh)
-	defer os.RemoveAll(socketPath)
+	if err := Start(t.Context(), socketPath, Limits{}, testCmdCh, slog.Default(), metrics.New()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
 
 	// Wait for socket to be ready with retry logic
 	if err := waitForSocket(socketPath, 2*time.Second); err != nil {
@@ -183,12 +190,12 @@ func TestStartCommandReceiverDebugMode(t *testing.T) {
 
 func TestStartCommandReceiverInvalidCommand(t *testing.T) {
 	// Set up test environment
-	pid := 12346
-	debugMode := false
+	socketPath := filepath.Join(t.TempDir(), "native-app.12346.sock")
 	testCmdCh := make(chan CommandWithConn, 1)
 
-	socketPath := Start(pid, debugMode, testCmdCh)
-	defer os.RemoveAll(socketPath)
+	if err := Start(t.Context(), socketPath, Limits{}, testCmdCh, slog.Default(), metrics.New()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
 
 	// Wait for socket to be ready with retry logic
 	if err := waitForSocket(socketPath, 2*time.Second); err != nil {
@@ -217,3 +224,64 @@ func TestStartCommandReceiverInvalidCommand(t *testing.T) {
 		// This is expected - no command should be sent
 	}
 }
+
+func TestStartCommandReceiverLimits(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "native-app.sock")
+	testCmdCh := make(chan CommandWithConn, 1)
+
+	// Start listens before returning, so no need to wait for the socket
+	limits := Limits{Timeout: 200 * time.Millisecond, MaxConns: 1}
+	if err := Start(t.Context(), socketPath, limits, testCmdCh, slog.Default(), metrics.New()); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	// A client that never sends its command holds the only slot
+	stuck, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect to socket: %v", err)
+	}
+	defer stuck.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	rejected, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to connect to socket: %v", err)
+	}
+	defer rejected.Close()
+	rejected.SetDeadline(time.Now().Add(time.Second))
+	reply, _ := io.ReadAll(rejected)
+	if string(reply) != "error: too many connections\n" {
+		t.Errorf("second client got %q, want refusal", reply)
+	}
+
+	// The deadline closes the stuck client and frees its slot
+	stuck.SetDeadline(time.Now().Add(time.Second))
+	if _, err := io.ReadAll(stuck); err != nil {
+		t.Errorf("stuck client read error = %v, want EOF", err)
+	}
+	select {
+	case cw := <-testCmdCh:
+		t.Errorf("stuck client produced command %T", cw.Cmd)
+	default:
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		conn, err := net.Dial("unix", socketPath)
+		if err != nil {
+			t.Fatalf("Failed to connect to socket: %v", err)
+		}
+		fmt.Fprintln(conn, "ping")
+		select {
+		case cw := <-testCmdCh:
+			cw.Conn.Close()
+			conn.Close()
+			return
+		case <-time.After(50 * time.Millisecond):
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("slot was not freed after the deadline")
+		}
+	}
+}
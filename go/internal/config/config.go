@@ -0,0 +1,440 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"rofi-chrome-tab/internal/listfmt"
+)
+
+// EnvPrefix is the prefix of every environment variable that overrides a
+// configuration value.
+const EnvPrefix = "ROFI_CHROME_TAB_"
+
+type Config struct {
+	SocketDir     string     `json:"socket_dir"`
+	Debug         bool       `json:"debug"`
+	Log           LogConfig  `json:"log"`
+	List          ListConfig `json:"list"`
+	ExcludedHosts []string   `json:"excluded_hosts"`
+	FocusBackend  string     `json:"focus_backend"`
+	// MetricsSocket is the unix socket serving Prometheus metrics, with the
+	// host's pid added to its name; empty disables it.
+	MetricsSocket string        `json:"metrics_socket"`
+	Privacy       PrivacyConfig `json:"privacy"`
+	Commands      CommandConfig `json:"commands"`
+	// DataDir holds saved sessions and snapshots; empty means
+	// $XDG_DATA_HOME/rofi-chrome-tab.
+	DataDir string `json:"data_dir"`
+	// CacheDir holds site icons; empty means
+	// $XDG_CACHE_HOME/rofi-chrome-tab.
+	CacheDir  string         `json:"cache_dir"`
+	Snapshots SnapshotConfig `json:"snapshots"`
+	// MaxClosedTabs is how many closed tabs are remembered for reopen; 0
+	// disables the journal.
+	MaxClosedTabs int `json:"max_closed_tabs"`
+	// MPRIS publishes tabs playing sound as media players on the D-Bus
+	// session bus.
+	MPRIS      bool            `json:"mpris"`
+	Thumbnails ThumbnailConfig `json:"thumbnails"`
+}
+
+type ThumbnailConfig struct {
+	// Enabled has the extension send a small image of each tab it shows,
+	// for pickers to preview.
+	Enabled bool `json:"enabled"`
+	// Keep is the number of thumbnails kept, of the most recently shown
+	// tabs.
+	Keep int `json:"keep"`
+}
+
+type CommandConfig struct {
+	// TimeoutMS bounds how long a client may take to send its command and
+	// read the reply.
+	TimeoutMS int `json:"timeout_ms"`
+	// MaxConnections is the number of clients served at once; further
+	// connections are refused.
+	MaxConnections int `json:"max_connections"`
+}
+
+// Timeout returns TimeoutMS as a duration.
+func (c CommandConfig) Timeout() time.Duration {
+	return time.Duration(c.TimeoutMS) * time.Millisecond
+}
+
+type SnapshotConfig struct {
+	// IntervalMinutes is the time between snapshots of the open tabs; 0
+	// disables periodic snapshots. One is also taken on shutdown.
+	IntervalMinutes int `json:"interval_minutes"`
+	// Keep is the number of snapshots kept.
+	Keep int `json:"keep"`
+}
+
+// Interval returns IntervalMinutes as a duration.
+func (c SnapshotConfig) Interval() time.Duration {
+	return time.Duration(c.IntervalMinutes) * time.Minute
+}
+
+type PrivacyConfig struct {
+	// Enabled keeps incognito tabs out of logs and anything stored on disk.
+	Enabled bool `json:"enabled"`
+	// RedactedHosts are glob patterns of hosts whose titles are never shown,
+	// logged or stored.
+	RedactedHosts []string `json:"redacted_hosts"`
+}
+
+type LogConfig struct {
+	// Path is the log file; empty means
+	// $XDG_STATE_HOME/rofi-chrome-tab/host.log.
+	Path   string `json:"path"`
+	Level  string `json:"level"`
+	Format string `json:"format"`
+	// MaxSizeMB is the size at which the log is rotated; 0 disables rotation.
+	MaxSizeMB  int `json:"max_size_mb"`
+	MaxBackups int `json:"max_backups"`
+}
+
+type ListConfig struct {
+	Format string `json:"format"`
+	Sort   string `json:"sort"`
+	// Template is a text/template for each row; it takes precedence over Format.
+	Template string `json:"template"`
+	// Incognito selects incognito tabs: include, exclude or only.
+	Incognito string `json:"incognito"`
+}
+
+var (
+	LogLevels      = []string{"debug", "info", "warn", "error", "off"}
+	LogFormats     = []string{"text", "json"}
+	ListFormats    = []string{"csv", "tsv"}
+	ListSorts      = []string{"none", "id", "title", "host"}
+	IncognitoModes = []string{"include", "exclude", "only"}
+	FocusBackends  = []string{"i3", "sway", "none"}
+)
+
+func Default() Config {
+	return Config{
+		SocketDir: "/tmp",
+		Log: LogConfig{
+			Path:       "/tmp/rofi-chrome-tab.log",
+			Level:      "off",
+			Format:     "text",
+			MaxSizeMB:  10,
+			MaxBackups: 3,
+		},
+		List: ListConfig{
+			Format:    "csv",
+			Sort:      "none",
+			Incognito: "include",
+		},
+		FocusBackend: "i3",
+		Commands: CommandConfig{
+			TimeoutMS:      5000,
+			MaxConnections: 16,
+		},
+		MaxClosedTabs: 50,
+		Snapshots: SnapshotConfig{
+			IntervalMinutes: 10,
+			Keep:            12,
+		},
+		Thumbnails: ThumbnailConfig{
+			Keep: 20,
+		},
+	}
+}
+
+// Path returns the location of the configuration file. ROFI_CHROME_TAB_CONFIG
+// takes precedence over $XDG_CONFIG_HOME/rofi-chrome-tab/config.json.
+func Path() (string, error) {
+	if p := os.Getenv(EnvPrefix + "CONFIG"); p != "" {
+		return p, nil
+	}
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine config directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "rofi-chrome-tab", "config.json"), nil
+}
+
+// Load reads the configuration file, applies environment overrides and
+// validates the result.
+func Load() (Config, error) {
+	p, err := Path()
+	if err != nil {
+		return Config{}, err
+	}
+	cfg, err := LoadFile(p)
+	if err != nil {
+		return Config{}, err
+	}
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	// Debug mode has always implied logging
+	if cfg.Debug && cfg.Log.Level == "off" {
+		cfg.Log.Level = "debug"
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// LoadFile reads the configuration file at p on top of the defaults. A missing
+// file is not an error.
+func LoadFile(p string) (Config, error) {
+	cfg := Default()
+
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return Config{}, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return Config{}, fmt.Errorf("%s: %w", p, err)
+	}
+	return cfg, nil
+}
+
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	var errs []error
+
+	str := func(name string, dst *string) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			*dst = v
+		}
+	}
+	str("SOCKET_DIR", &cfg.SocketDir)
+	str("LOG_PATH", &cfg.Log.Path)
+	str("LOG_LEVEL", &cfg.Log.Level)
+	str("LOG_FORMAT", &cfg.Log.Format)
+	str("LIST_FORMAT", &cfg.List.Format)
+	str("LIST_SORT", &cfg.List.Sort)
+	str("LIST_TEMPLATE", &cfg.List.Template)
+	str("LIST_INCOGNITO", &cfg.List.Incognito)
+	str("FOCUS_BACKEND", &cfg.FocusBackend)
+	str("METRICS_SOCKET", &cfg.MetricsSocket)
+	str("DATA_DIR", &cfg.DataDir)
+	str("CACHE_DIR", &cfg.CacheDir)
+
+	integer := func(name string, dst *int) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: invalid integer %q", EnvPrefix, name, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	integer("COMMAND_TIMEOUT_MS", &cfg.Commands.TimeoutMS)
+	integer("MAX_CONNECTIONS", &cfg.Commands.MaxConnections)
+	integer("MAX_CLOSED_TABS", &cfg.MaxClosedTabs)
+	integer("SNAPSHOT_INTERVAL_MINUTES", &cfg.Snapshots.IntervalMinutes)
+	integer("SNAPSHOT_KEEP", &cfg.Snapshots.Keep)
+	integer("THUMBNAIL_KEEP", &cfg.Thumbnails.Keep)
+
+	boolean := func(name string, dst *bool) {
+		if v, ok := lookup(EnvPrefix + name); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s%s: invalid boolean %q", EnvPrefix, name, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	boolean("DEBUG", &cfg.Debug)
+	boolean("PRIVACY", &cfg.Privacy.Enabled)
+	boolean("MPRIS", &cfg.MPRIS)
+	boolean("THUMBNAILS", &cfg.Thumbnails.Enabled)
+
+	if v, ok := lookup(EnvPrefix + "EXCLUDED_HOSTS"); ok {
+		cfg.ExcludedHosts = splitList(v)
+	}
+	if v, ok := lookup(EnvPrefix + "REDACTED_HOSTS"); ok {
+		cfg.Privacy.RedactedHosts = splitList(v)
+	}
+
+	return errors.Join(errs...)
+}
+
+// splitList splits a comma separated environment value.
+func splitList(v string) []string {
+	var list []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Validate reports every invalid field at once.
+func (c Config) Validate() error {
+	var errs []error
+
+	oneOf := func(field, v string, allowed []string) {
+		for _, a := range allowed {
+			if v == a {
+				return
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: invalid value %q (want one of %s)", field, v, strings.Join(allowed, ", ")))
+	}
+
+	if c.SocketDir == "" {
+		errs = append(errs, errors.New("socket_dir: must not be empty"))
+	}
+	oneOf("log.level", c.Log.Level, LogLevels)
+	oneOf("log.format", c.Log.Format, LogFormats)
+	if c.Log.MaxSizeMB < 0 {
+		errs = append(errs, fmt.Errorf("log.max_size_mb: must not be negative"))
+	}
+	if c.Log.MaxBackups < 0 {
+		errs = append(errs, fmt.Errorf("log.max_backups: must not be negative"))
+	}
+	oneOf("list.format", c.List.Format, ListFormats)
+	oneOf("list.sort", c.List.Sort, ListSorts)
+	if c.List.Template != "" {
+		if _, err := listfmt.Parse(c.List.Template); err != nil {
+			errs = append(errs, fmt.Errorf("list.template: %v", err))
+		}
+	}
+	oneOf("focus_backend", c.FocusBackend, FocusBackends)
+	oneOf("list.incognito", c.List.Incognito, IncognitoModes)
+	for i, h := range c.ExcludedHosts {
+		if _, err := path.Match(h, ""); err != nil {
+			errs = append(errs, fmt.Errorf("excluded_hosts[%d]: invalid pattern %q", i, h))
+		}
+	}
+	for i, h := range c.Privacy.RedactedHosts {
+		if _, err := path.Match(h, ""); err != nil {
+			errs = append(errs, fmt.Errorf("privacy.redacted_hosts[%d]: invalid pattern %q", i, h))
+		}
+	}
+
+	if c.Commands.TimeoutMS <= 0 {
+		errs = append(errs, errors.New("commands.timeout_ms: must be positive"))
+	}
+	if c.Commands.MaxConnections <= 0 {
+		errs = append(errs, errors.New("commands.max_connections: must be positive"))
+	}
+	if c.MaxClosedTabs < 0 {
+		errs = append(errs, errors.New("max_closed_tabs: must not be negative"))
+	}
+	if c.Snapshots.IntervalMinutes < 0 {
+		errs = append(errs, errors.New("snapshots.interval_minutes: must not be negative"))
+	}
+	if c.Snapshots.Keep < 1 {
+		errs = append(errs, errors.New("snapshots.keep: must be at least 1"))
+	}
+	if c.Thumbnails.Keep < 1 {
+		errs = append(errs, errors.New("thumbnails.keep: must be at least 1"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// RowTemplate returns the text of the template used to render list rows.
+func (c ListConfig) RowTemplate() string {
+	if c.Template != "" {
+		return c.Template
+	}
+	return listfmt.Formats[c.Format]
+}
+
+// DataPath returns the directory for data the host keeps, such as saved
+// sessions.
+func (c Config) DataPath() (string, error) {
+	if c.DataDir != "" {
+		return c.DataDir, nil
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine data directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return filepath.Join(dir, "rofi-chrome-tab"), nil
+}
+
+// FilePath returns the log file. Without a configured path it lives in the
+// state directory, so that logging can be turned on at runtime.
+func (c LogConfig) FilePath() (string, error) {
+	if c.Path != "" {
+		return c.Path, nil
+	}
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine state directory: %w", err)
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "rofi-chrome-tab", "host.log"), nil
+}
+
+// CachePath returns the directory for files the host can recreate, such as
+// site icons.
+func (c Config) CachePath() (string, error) {
+	if c.CacheDir != "" {
+		return c.CacheDir, nil
+	}
+	dir := os.Getenv("XDG_CACHE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot determine cache directory: %w", err)
+		}
+		dir = filepath.Join(home, ".cache")
+	}
+	return filepath.Join(dir, "rofi-chrome-tab"), nil
+}
+
+// SocketPath returns the command socket of the host with the given pid. In
+// debug mode a fixed name is used so the socket is easy to find.
+func (c Config) SocketPath(pid int) string {
+	if c.Debug {
+		return filepath.Join(c.SocketDir, "native-app.sock")
+	}
+	return filepath.Join(c.SocketDir, fmt.Sprintf("native-app.%d.sock", pid))
+}
+
+// MetricsSocketPath returns the metrics socket of the host with the given
+// pid: MetricsSocket with the pid before its extension, so that hosts of
+// several browsers do not take over each other's socket.
+func (c Config) MetricsSocketPath(pid int) string {
+	ext := filepath.Ext(c.MetricsSocket)
+	return fmt.Sprintf("%s.%d%s", strings.TrimSuffix(c.MetricsSocket, ext), pid, ext)
+}
+
+// IsExcluded reports whether host matches one of the excluded host patterns.
+func (c Config) IsExcluded(host string) bool {
+	for _, p := range c.ExcludedHosts {
+		if ok, _ := path.Match(p, host); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,212 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadFileMissing(t *testing.T) {
+	cfg, err := LoadFile(filepath.Join(t.TempDir(), "config.json"))
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.SocketDir != Default().SocketDir || cfg.List != Default().List {
+		t.Errorf("LoadFile() = %+v, want defaults", cfg)
+	}
+}
+
+func TestLoadFileOverridesDefaults(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	data := `{"socket_dir": "/run/user/1000", "list": {"sort": "title"}, "excluded_hosts": ["*.bank.test"]}`
+	if err := os.WriteFile(p, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadFile(p)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if cfg.SocketDir != "/run/user/1000" {
+		t.Errorf("SocketDir = %q", cfg.SocketDir)
+	}
+	if cfg.List.Sort != "title" || cfg.List.Format != "csv" {
+		t.Errorf("List = %+v, want sort overridden and format defaulted", cfg.List)
+	}
+	if !cfg.IsExcluded("www.bank.test") || cfg.IsExcluded("bank.test.evil") {
+		t.Errorf("IsExcluded() does not match patterns %v", cfg.ExcludedHosts)
+	}
+}
+
+func TestLoadFileUnknownField(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(p, []byte(`{"sockte_dir": "/tmp"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := LoadFile(p)
+	if err == nil || !strings.Contains(err.Error(), "sockte_dir") {
+		t.Fatalf("LoadFile() error = %v, want unknown field error", err)
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"ROFI_CHROME_TAB_SOCKET_DIR":      "/run/rct",
+		"ROFI_CHROME_TAB_LOG_LEVEL":       "info",
+		"ROFI_CHROME_TAB_DEBUG":           "true",
+		"ROFI_CHROME_TAB_EXCLUDED_HOSTS":  "a.test, b.test,",
+		"ROFI_CHROME_TAB_MAX_CONNECTIONS": "4",
+		"ROFI_CHROME_TAB_MPRIS":           "1",
+		"ROFI_CHROME_TAB_THUMBNAILS":      "true",
+		"ROFI_CHROME_TAB_THUMBNAIL_KEEP":  "5",
+	}
+	lookup := func(k string) (string, bool) {
+		v, ok := env[k]
+		return v, ok
+	}
+
+	cfg := Default()
+	if err := applyEnv(&cfg, lookup); err != nil {
+		t.Fatalf("applyEnv() error = %v", err)
+	}
+	if cfg.SocketDir != "/run/rct" || cfg.Log.Level != "info" || !cfg.Debug || !cfg.MPRIS {
+		t.Errorf("applyEnv() = %+v", cfg)
+	}
+	if len(cfg.ExcludedHosts) != 2 || cfg.ExcludedHosts[1] != "b.test" {
+		t.Errorf("ExcludedHosts = %q", cfg.ExcludedHosts)
+	}
+	if cfg.Commands.MaxConnections != 4 {
+		t.Errorf("Commands.MaxConnections = %d, want 4", cfg.Commands.MaxConnections)
+	}
+	if !cfg.Thumbnails.Enabled || cfg.Thumbnails.Keep != 5 {
+		t.Errorf("Thumbnails = %+v", cfg.Thumbnails)
+	}
+
+	// An invalid value is reported and leaves the setting alone
+	env = map[string]string{"ROFI_CHROME_TAB_DEBUG": "maybe", "ROFI_CHROME_TAB_THUMBNAILS": "on"}
+	if err := applyEnv(&cfg, lookup); err == nil || !strings.Contains(err.Error(), "THUMBNAILS") {
+		t.Errorf("applyEnv() error = %v, want errors for invalid booleans", err)
+	}
+	if !cfg.Debug || !cfg.Thumbnails.Enabled {
+		t.Errorf("invalid booleans changed Debug = %v, Thumbnails.Enabled = %v", cfg.Debug, cfg.Thumbnails.Enabled)
+	}
+
+	env = map[string]string{"ROFI_CHROME_TAB_COMMAND_TIMEOUT_MS": "5s"}
+	if err := applyEnv(&cfg, lookup); err == nil {
+		t.Error("applyEnv() expected error for invalid integer")
+	}
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	cfg := Default()
+	cfg.Log.Level = "verbose"
+	cfg.List.Sort = "random"
+	cfg.FocusBackend = "xmonad"
+	cfg.ExcludedHosts = []string{"[bad"}
+	cfg.List.Template = "{{.Title"
+	cfg.List.Incognito = "sometimes"
+	cfg.Privacy.RedactedHosts = []string{"[bad"}
+	cfg.Commands.TimeoutMS = 0
+	cfg.Commands.MaxConnections = -1
+	cfg.MaxClosedTabs = -1
+	cfg.Snapshots.Keep = 0
+	cfg.Thumbnails.Keep = 0
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() expected error")
+	}
+	for _, field := range []string{"log.level", "list.sort", "focus_backend", "excluded_hosts[0]", "list.template", "list.incognito", "privacy.redacted_hosts[0]",
+		"commands.timeout_ms", "commands.max_connections", "max_closed_tabs",
+		"snapshots.keep", "thumbnails.keep"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Validate() error %q does not mention %s", err, field)
+		}
+	}
+
+	if err := Default().Validate(); err != nil {
+		t.Errorf("Default().Validate() error = %v", err)
+	}
+}
+
+func TestLogFilePath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/home/u/.local/state")
+	cfg := Default()
+	cfg.Log.Path = ""
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Validate() with empty log.path error = %v", err)
+	}
+	if got, err := cfg.Log.FilePath(); err != nil || got != "/home/u/.local/state/rofi-chrome-tab/host.log" {
+		t.Errorf("FilePath() = %q, %v", got, err)
+	}
+	cfg.Log.Path = "/var/log/rct.log"
+	if got, _ := cfg.Log.FilePath(); got != "/var/log/rct.log" {
+		t.Errorf("FilePath() = %q", got)
+	}
+}
+
+func TestSocketPath(t *testing.T) {
+	cfg := Default()
+	cfg.SocketDir = "/run/rct"
+	if got := cfg.SocketPath(42); got != "/run/rct/native-app.42.sock" {
+		t.Errorf("SocketPath() = %q", got)
+	}
+	cfg.Debug = true
+	if got := cfg.SocketPath(42); got != "/run/rct/native-app.sock" {
+		t.Errorf("SocketPath() in debug mode = %q", got)
+	}
+}
+
+func TestMetricsSocketPath(t *testing.T) {
+	cfg := Default()
+	for in, want := range map[string]string{
+		"/run/rct/metrics.sock": "/run/rct/metrics.42.sock",
+		"/run/rct/metrics":      "/run/rct/metrics.42",
+	} {
+		cfg.MetricsSocket = in
+		if got := cfg.MetricsSocketPath(42); got != want {
+			t.Errorf("MetricsSocketPath() of %q = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRowTemplate(t *testing.T) {
+	list := ListConfig{Format: "tsv"}
+	if got := list.RowTemplate(); got != "{{.PID}}\t{{.ID}}\t{{.Host}}\t{{.Title}}" {
+		t.Errorf("RowTemplate() = %q", got)
+	}
+	list.Template = "{{.Title}}"
+	if got := list.RowTemplate(); got != "{{.Title}}" {
+		t.Errorf("RowTemplate() with template = %q", got)
+	}
+}
+
+func TestDataPath(t *testing.T) {
+	t.Setenv("XDG_DATA_HOME", "/xdg/data")
+	cfg := Default()
+	if got, err := cfg.DataPath(); err != nil || got != "/xdg/data/rofi-chrome-tab" {
+		t.Errorf("DataPath() = %q, %v", got, err)
+	}
+	cfg.DataDir = "/srv/rct"
+	if got, err := cfg.DataPath(); err != nil || got != "/srv/rct" {
+		t.Errorf("DataPath() with data_dir = %q, %v", got, err)
+	}
+}
+
+func TestCachePath(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", "/xdg/cache")
+	cfg := Default()
+	if got, err := cfg.CachePath(); err != nil || got != "/xdg/cache/rofi-chrome-tab" {
+		t.Errorf("CachePath() = %q, %v", got, err)
+	}
+	t.Setenv("XDG_CACHE_HOME", "")
+	t.Setenv("HOME", "/home/u")
+	if got, err := cfg.CachePath(); err != nil || got != "/home/u/.cache/rofi-chrome-tab" {
+		t.Errorf("CachePath() without XDG_CACHE_HOME = %q, %v", got, err)
+	}
+	cfg.CacheDir = "/srv/cache"
+	if got, err := cfg.CachePath(); err != nil || got != "/srv/cache" {
+		t.Errorf("CachePath() with cache_dir = %q, %v", got, err)
+	}
+}
@@ -0,0 +1,31 @@
+// Package dataurl decodes data: URLs, the form in which the extension sends
+// images it reads in the browser.
+package dataurl
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Decode returns the data of a data: URL, either base64 or percent encoded.
+// The media type is ignored.
+func Decode(s string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(s, "data:")
+	if !ok {
+		return nil, errors.New("not a data: URL")
+	}
+	meta, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return nil, errors.New("data: URL without data")
+	}
+	if strings.HasSuffix(meta, ";base64") {
+		return base64.StdEncoding.DecodeString(strings.TrimRight(data, "\r\n"))
+	}
+	decoded, err := url.PathUnescape(data)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(decoded), nil
+}
@@ -0,0 +1,35 @@
+package dataurl
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr string
+	}{
+		{"data:image/png;base64,aGVsbG8=", "hello", ""},
+		{"data:;base64,aGVsbG8=\n", "hello", ""},
+		{"data:image/svg+xml,%3Csvg%2F%3E", "<svg/>", ""},
+		{"data:,a+b", "a+b", ""},
+		{"https://example.com/favicon.ico", "", "not a data: URL"},
+		{"data:image/png;base64", "", "without data"},
+		{"data:image/png;base64,!!", "", "illegal base64"},
+		{"data:text/plain,%zz", "", "invalid URL escape"},
+	}
+	for _, tt := range tests {
+		got, err := Decode(tt.in)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Decode(%q) error = %v, want %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("Decode(%q) = %q, %v, want %q", tt.in, got, err, tt.want)
+		}
+	}
+}
@@ -1,8 +0,0 @@
-package debug
-
-import "os"
-
-func IsDebugMode() bool {
-	_, err := os.Stat("/tmp/.rofi-chrome-tab.debug")
-	return err == nil
-}
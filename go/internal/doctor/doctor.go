@@ -0,0 +1,263 @@
+package doctor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/install"
+	"rofi-chrome-tab/internal/registry"
+)
+
+type Status int
+
+const (
+	OK Status = iota
+	Warn
+	Fail
+)
+
+func (s Status) String() string {
+	switch s {
+	case OK:
+		return "ok"
+	case Warn:
+		return "warn"
+	default:
+		return "FAIL"
+	}
+}
+
+// Result is the outcome of one check, with a suggested fix when it did not
+// pass.
+type Result struct {
+	Status  Status
+	Check   string
+	Message string
+	Fix     string
+}
+
+// Env is what the checks inspect.
+type Env struct {
+	ConfigPath string
+	Config     config.Config
+	// ConfigErr is the error from loading the configuration, if any.
+	ConfigErr  error
+	ConfigHome string
+	LookPath   func(string) (string, error)
+	// Command runs a program and returns its combined output.
+	Command func(ctx context.Context, name string, arg ...string) ([]byte, error)
+	Timeout time.Duration
+}
+
+func runCommand(ctx context.Context, name string, arg ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, arg...).CombinedOutput()
+}
+
+// DefaultEnv loads the configuration the host would use.
+func DefaultEnv() Env {
+	env := Env{LookPath: exec.LookPath, Command: runCommand, Timeout: time.Second}
+	env.ConfigPath, _ = config.Path()
+	env.Config, env.ConfigErr = config.Load()
+	if env.ConfigErr != nil {
+		env.Config = config.Default()
+	}
+	env.ConfigHome, _ = install.ConfigHome()
+	return env
+}
+
+// Run performs every check.
+func Run(env Env) []Result {
+	var results []Result
+	results = append(results, checkConfig(env))
+	results = append(results, checkManifests(env)...)
+	results = append(results, checkSockets(env)...)
+	results = append(results, checkFocus(env))
+	return results
+}
+
+// Print writes results and reports whether any check failed.
+func Print(w io.Writer, results []Result) bool {
+	failed := false
+	for _, r := range results {
+		fmt.Fprintf(w, "[%s] %s: %s\n", r.Status, r.Check, r.Message)
+		if r.Fix != "" && r.Status != OK {
+			fmt.Fprintf(w, "       fix: %s\n", r.Fix)
+		}
+		if r.Status == Fail {
+			failed = true
+		}
+	}
+	return failed
+}
+
+func checkConfig(env Env) Result {
+	if env.ConfigErr != nil {
+		return Result{Fail, "config", env.ConfigErr.Error(), "edit " + env.ConfigPath}
+	}
+	if _, err := os.Stat(env.ConfigPath); err != nil {
+		return Result{OK, "config", "no config file, using defaults", ""}
+	}
+	return Result{OK, "config", env.ConfigPath + " is valid", ""}
+}
+
+func checkManifests(env Env) []Result {
+	var results []Result
+	detected := 0
+	for _, b := range install.Browsers {
+		// A browser counts as installed once it has created its config directory
+		if _, err := os.Stat(filepath.Dir(b.Dir(false, env.ConfigHome))); err != nil {
+			continue
+		}
+		detected++
+		results = append(results, checkManifest(env, b))
+	}
+	if detected == 0 {
+		results = append(results, Result{Warn, "manifest", "no supported browser found in " + env.ConfigHome,
+			"start the browser once, then run: rofi-chrome-tab install"})
+	}
+	return results
+}
+
+func checkManifest(env Env, b install.Browser) Result {
+	check := "manifest " + b.Name
+	fix := fmt.Sprintf("rofi-chrome-tab install --browser %s --extension-id <ID>", b.Name)
+
+	p := b.ManifestPath(false, env.ConfigHome)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		p = b.ManifestPath(true, "")
+		data, err = os.ReadFile(p)
+	}
+	if err != nil {
+		return Result{Fail, check, "not installed", fix}
+	}
+
+	var m install.Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Result{Fail, check, fmt.Sprintf("%s: %v", p, err), fix}
+	}
+	if m.Name != install.HostName {
+		return Result{Fail, check, fmt.Sprintf("%s: name is %q, want %q", p, m.Name, install.HostName), fix}
+	}
+	if m.Type != "stdio" {
+		return Result{Fail, check, fmt.Sprintf("%s: type is %q, want \"stdio\"", p, m.Type), fix}
+	}
+	info, err := os.Stat(m.Path)
+	if err != nil {
+		return Result{Fail, check, fmt.Sprintf("%s: host %s does not exist", p, m.Path), fix + " --path <binary>"}
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return Result{Fail, check, fmt.Sprintf("%s: host %s is not executable", p, m.Path), "chmod +x " + m.Path}
+	}
+	if len(m.AllowedOrigins) == 0 {
+		return Result{Fail, check, p + ": no allowed_origins", fix}
+	}
+	for _, origin := range m.AllowedOrigins {
+		id, ok := strings.CutPrefix(origin, "chrome-extension://")
+		id, hasSlash := strings.CutSuffix(id, "/")
+		if !ok || !hasSlash || !install.ValidExtensionID(id) {
+			return Result{Fail, check, fmt.Sprintf("%s: malformed origin %q (want chrome-extension://<32 letters a-p>/)", p, origin), fix}
+		}
+	}
+	return Result{OK, check, p, ""}
+}
+
+func checkSockets(env Env) []Result {
+	dir := env.Config.SocketDir
+	paths, _ := filepath.Glob(filepath.Join(dir, "native-app*.sock"))
+	if len(paths) == 0 {
+		return []Result{{Warn, "sockets", "no host sockets in " + dir,
+			"open the browser with the extension enabled; check chrome://extensions for errors"}}
+	}
+
+	var results []Result
+	for _, p := range paths {
+		reply, err := ping(p, env.Timeout)
+		if err != nil {
+			results = append(results, Result{Warn, "socket", fmt.Sprintf("%s is stale: %v", p, err), "rm " + p})
+			continue
+		}
+		results = append(results, Result{OK, "socket", fmt.Sprintf("%s: %s", p, reply), ""})
+	}
+
+	instances, _ := registry.List(dir)
+	for _, inst := range instances {
+		if !inst.Alive() {
+			results = append(results, Result{Warn, "registry", fmt.Sprintf("instance %d is not running", inst.PID),
+				"rm " + registry.Path(dir, inst.PID)})
+		}
+	}
+	return results
+}
+
+// ping sends the ping command to a host socket and returns its reply.
+func ping(path string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("unix", path, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := io.WriteString(conn, "ping\n"); err != nil {
+		return "", err
+	}
+	reply, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	reply = strings.TrimSpace(reply)
+	if !strings.HasPrefix(reply, "pong") {
+		return "", fmt.Errorf("unexpected reply %q", reply)
+	}
+	return reply, nil
+}
+
+func checkFocus(env Env) Result {
+	backend := env.Config.FocusBackend
+	check := "focus"
+	switch backend {
+	case "none":
+		return Result{OK, check, "backend none: the window is not raised after select", ""}
+	case "i3", "sway":
+		bin := "i3-msg"
+		if backend == "sway" {
+			bin = "swaymsg"
+		}
+		if _, err := env.LookPath(bin); err != nil {
+			return Result{Fail, check, fmt.Sprintf("backend %s: %s not found in PATH", backend, bin),
+				"install " + backend + " or set focus_backend in the config"}
+		}
+		// swaymsg only finds sway through SWAYSOCK; i3-msg also asks the X
+		// server, so it is simply tried
+		if backend == "sway" && os.Getenv("SWAYSOCK") == "" {
+			return Result{Warn, check, "backend sway: SWAYSOCK is not set in this shell",
+				"run doctor inside your sway session"}
+		}
+		if backend == "i3" {
+			ctx, cancel := context.WithTimeout(context.Background(), env.Timeout)
+			defer cancel()
+			if out, err := env.Command(ctx, bin, "-t", "get_version"); err != nil {
+				msg := strings.TrimSpace(string(out))
+				if msg == "" {
+					msg = err.Error()
+				}
+				return Result{Warn, check, "backend i3: cannot reach i3: " + msg,
+					"run doctor inside your i3 session"}
+			}
+		}
+		return Result{OK, check, "backend " + backend + " via " + bin, ""}
+	default:
+		return Result{Fail, check, "unknown backend " + backend, "set focus_backend to i3, sway or none"}
+	}
+}
@@ -0,0 +1,205 @@
+package doctor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/install"
+)
+
+func testEnv(t *testing.T) Env {
+	t.Helper()
+	cfg := config.Default()
+	cfg.SocketDir = t.TempDir()
+	cfg.FocusBackend = "none"
+	return Env{
+		ConfigPath: filepath.Join(t.TempDir(), "config.json"),
+		Config:     cfg,
+		ConfigHome: t.TempDir(),
+		LookPath:   func(string) (string, error) { return "", errors.New("not found") },
+		Command: func(context.Context, string, ...string) ([]byte, error) {
+			return nil, errors.New("not found")
+		},
+		Timeout: time.Second,
+	}
+}
+
+func findResult(results []Result, check string) (Result, bool) {
+	for _, r := range results {
+		if r.Check == check {
+			return r, true
+		}
+	}
+	return Result{}, false
+}
+
+func TestCheckManifests(t *testing.T) {
+	env := testEnv(t)
+	exe := filepath.Join(t.TempDir(), "rofi-chrome-tab")
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// chrome has a valid manifest, chromium is detected but has none
+	m, err := install.NewManifest(exe, []string{"abcdefghijklmnopabcdefghijklmnop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chrome, _ := install.Lookup("chrome")
+	if err := install.Install(m, install.Options{Browsers: chrome, ConfigHome: env.ConfigHome}, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(env.ConfigHome, "chromium"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	results := checkManifests(env)
+	if r, ok := findResult(results, "manifest chrome"); !ok || r.Status != OK {
+		t.Errorf("chrome result = %+v", r)
+	}
+	if r, ok := findResult(results, "manifest chromium"); !ok || r.Status != Fail || !strings.Contains(r.Fix, "--browser chromium") {
+		t.Errorf("chromium result = %+v", r)
+	}
+	if _, ok := findResult(results, "manifest edge"); ok {
+		t.Error("edge checked although not detected")
+	}
+
+	// A malformed origin and a missing binary are reported
+	p := chrome[0].ManifestPath(false, env.ConfigHome)
+	m.AllowedOrigins = []string{"chrome-extension://nope"}
+	writeJSON(t, p, m)
+	if r, _ := findResult(checkManifests(env), "manifest chrome"); r.Status != Fail || !strings.Contains(r.Message, "malformed origin") {
+		t.Errorf("malformed origin result = %+v", r)
+	}
+	m.Path = "/nonexistent/rofi-chrome-tab"
+	writeJSON(t, p, m)
+	if r, _ := findResult(checkManifests(env), "manifest chrome"); r.Status != Fail || !strings.Contains(r.Message, "does not exist") {
+		t.Errorf("missing binary result = %+v", r)
+	}
+}
+
+func writeJSON(t *testing.T, p string, m install.Manifest) {
+	t.Helper()
+	data, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSockets(t *testing.T) {
+	env := testEnv(t)
+
+	live := filepath.Join(env.Config.SocketDir, "native-app.1.sock")
+	lis, err := net.Listen("unix", live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte("pong host=dev extension=1.1\n"))
+			conn.Close()
+		}
+	}()
+
+	stale := filepath.Join(env.Config.SocketDir, "native-app.2.sock")
+	if err := os.WriteFile(stale, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	results := checkSockets(env)
+	if len(results) != 2 {
+		t.Fatalf("checkSockets() = %+v", results)
+	}
+	for _, r := range results {
+		switch {
+		case strings.HasPrefix(r.Message, live):
+			if r.Status != OK || !strings.Contains(r.Message, "pong") {
+				t.Errorf("live socket result = %+v", r)
+			}
+		case strings.HasPrefix(r.Message, stale):
+			if r.Status != Warn || r.Fix != "rm "+stale {
+				t.Errorf("stale socket result = %+v", r)
+			}
+		default:
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
+
+func TestCheckConfigAndFocus(t *testing.T) {
+	env := testEnv(t)
+	env.ConfigErr = errors.New("invalid configuration: list.sort: invalid value")
+	if r := checkConfig(env); r.Status != Fail || !strings.Contains(r.Fix, env.ConfigPath) {
+		t.Errorf("checkConfig() = %+v", r)
+	}
+
+	env.Config.FocusBackend = "i3"
+	if r := checkFocus(env); r.Status != Fail {
+		t.Errorf("checkFocus() without i3-msg = %+v", r)
+	}
+	env.LookPath = func(string) (string, error) { return "/usr/bin/i3-msg", nil }
+	env.Command = func(_ context.Context, name string, arg ...string) ([]byte, error) {
+		return []byte("ERROR: Could not connect to i3 on socket \"\"\n"), errors.New("exit status 1")
+	}
+	if r := checkFocus(env); r.Status != Warn || !strings.Contains(r.Message, "Could not connect") {
+		t.Errorf("checkFocus() without i3 running = %+v", r)
+	}
+
+	// i3-msg finds i3 through the X server, so I3SOCK need not be set
+	var ran []string
+	env.Command = func(_ context.Context, name string, arg ...string) ([]byte, error) {
+		ran = append([]string{name}, arg...)
+		return []byte(`{"human_readable":"4.23"}`), nil
+	}
+	t.Setenv("I3SOCK", "")
+	if r := checkFocus(env); r.Status != OK {
+		t.Errorf("checkFocus() = %+v", r)
+	}
+	if want := "i3-msg -t get_version"; strings.Join(ran, " ") != want {
+		t.Errorf("ran %q, want %q", ran, want)
+	}
+
+	env.Config.FocusBackend = "sway"
+	t.Setenv("SWAYSOCK", "")
+	if r := checkFocus(env); r.Status != Warn || !strings.Contains(r.Message, "SWAYSOCK") {
+		t.Errorf("checkFocus() for sway without SWAYSOCK = %+v", r)
+	}
+	t.Setenv("SWAYSOCK", "/run/user/1000/sway-ipc.sock")
+	if r := checkFocus(env); r.Status != OK {
+		t.Errorf("checkFocus() for sway = %+v", r)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var buf bytes.Buffer
+	failed := Print(&buf, []Result{
+		{OK, "config", "valid", ""},
+		{Fail, "manifest chrome", "not installed", "rofi-chrome-tab install"},
+	})
+	if !failed {
+		t.Error("Print() did not report failure")
+	}
+	want := "[ok] config: valid\n[FAIL] manifest chrome: not installed\n       fix: rofi-chrome-tab install\n"
+	if buf.String() != want {
+		t.Errorf("Print() = %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,48 @@
+package event_receiver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/slog"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+func frame(msg string) []byte {
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(len(msg)))
+	return append(buf, msg...)
+}
+
+// FuzzStart feeds arbitrary stdin contents to the receiver, which must stop
+// cleanly at the end of input whatever the framing looks like.
+func FuzzStart(f *testing.F) {
+	f.Add(frame(`{"type":"updated","tabs":[{"id":1,"title":"Tab","host":"example.com"}]}`))
+	f.Add(append(frame(`{"type":"bogus"}`), frame(`{"type":"updated","tabs":[]}`)...))
+	f.Add(frame(`not json`))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Add([]byte{10, 0, 0, 0, '{'})
+	f.Add([]byte{1, 2})
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		evCh := make(chan protocol.Event)
+		done := Start(t.Context(), bytes.NewReader(data), evCh, slog.Default(), metrics.New())
+
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case ev := <-evCh:
+				if ev == nil {
+					t.Fatal("received nil event")
+				}
+			case <-done:
+				return
+			case <-timeout:
+				t.Fatal("receiver did not stop at end of input")
+			}
+		}
+	})
+}
@@ -1,43 +1,52 @@
 package event_receiver
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"io"
-	"log"
+	"log/slog"
 
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/nativemsg"
 	"rofi-chrome-tab/internal/protocol"
 )
 
-func Start(r io.Reader, evCh chan<- protocol.Event) {
+// Start reads events from r in the background, logging to logger and
+// counting them in reg. Messages that are too large or cannot be parsed are
+// reported as protocol.DroppedEvent. The returned channel is closed once r
+// can no longer be read, or once ctx is done and an event cannot be
+// delivered.
+func Start(ctx context.Context, r io.Reader, evCh chan<- protocol.Event, logger *slog.Logger, reg *metrics.Registry) <-chan struct{} {
+	done := make(chan struct{})
+	send := func(ev protocol.Event) bool {
+		select {
+		case evCh <- ev:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
 	// Receive events from stdin
 	go func() {
-		const maxMessageSize = 10 * 1024 * 1024 // 10MB limit
+		defer close(done)
+		reader := nativemsg.NewReader(r, nativemsg.DefaultMaxIncoming)
 		for {
-			// Read 4-byte length header
-			lenBuf := make([]byte, 4)
-			if _, err := io.ReadFull(r, lenBuf); err != nil {
-				if err == io.EOF {
-					log.Println("stdin closed")
-				} else {
-					log.Println("Error reading length header:", err)
+			buf, err := reader.ReadMessage()
+			if nativemsg.IsTooLarge(err) {
+				// The reader skipped the message; report it and go on
+				reg.OversizedMessage()
+				logger.Error("message too large, dropped", "err", err)
+				if !send(protocol.DroppedEvent{Reason: err.Error()}) {
+					return
 				}
-				return
-			}
-			length := binary.LittleEndian.Uint32(lenBuf)
-
-			// Validate message length to prevent excessive memory allocation
-			if length > maxMessageSize {
-				log.Printf("Message too large: %d bytes (max %d bytes), closing stdin receiver", length, maxMessageSize)
-				return
+				continue
 			}
-
-			// Read message body
-			buf := make([]byte, length)
-			if _, err := io.ReadFull(r, buf); err != nil {
+			if err != nil {
 				if err == io.EOF {
-					log.Println("stdin closed")
+					logger.Info("stdin closed")
 				} else {
-					log.Println("Error reading message body:", err)
+					logger.Error("error reading message", "err", err)
 				}
 				return
 			}
@@ -45,11 +54,24 @@ func Start(r io.Reader, evCh chan<- protocol.Event) {
 			// Parse event from bytes
 			ev, err := protocol.ParseEvent(buf)
 			if err != nil {
-				log.Println("Error parsing event:", err)
+				reg.ParseError("event")
+				if errors.Is(err, protocol.ErrUnknownEvent) {
+					logger.Warn("ignoring event", "err", err)
+					continue
+				}
+				logger.Warn("error parsing event, dropped", "err", err)
+				if !send(protocol.DroppedEvent{Reason: "corrupt message: " + err.Error()}) {
+					return
+				}
 				continue
 			}
-			log.Printf("Received event: %T", ev)
-			evCh <- ev
+			reg.EventReceived(ev.Type())
+			logger.Debug("received event", "type", ev.Type())
+			if !send(ev) {
+				return
+			}
 		}
 	}()
+
+	return done
 }
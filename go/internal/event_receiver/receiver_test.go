@@ -2,13 +2,17 @@ package event_receiver
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"encoding/json"
+	"log/slog"
 	"os"
 	"strconv"
 	"testing"
 	"time"
 
+	"rofi-chrome-tab/internal/metrics"
+	"rofi-chrome-tab/internal/nativemsg"
 	"rofi-chrome-tab/internal/protocol"
 )
 
@@ -42,7 +46,7 @@ func TestStartEventReceiver_ValidEvent(t *testing.T) {
 	}
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Write length header and message to stdin
 	length := uint32(len(jsonData))
@@ -86,7 +90,7 @@ func TestStartEventReceiver_EOF(t *testing.T) {
 	evCh := make(chan protocol.Event, 1)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Close the write end to simulate EOF
 	w.Close()
@@ -111,28 +115,35 @@ func TestStartEventReceiver_MessageTooLarge(t *testing.T) {
 	evCh := make(chan protocol.Event, 1)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
-	// Write a length header that exceeds the max message size (10MB)
-	const maxMessageSize = 10 * 1024 * 1024
-	length := uint32(maxMessageSize + 1)
-	var lenBuf [4]byte
-	binary.LittleEndian.PutUint32(lenBuf[:], length)
+	// Write a message that exceeds the max message size, then a valid one
+	go func() {
+		body := bytes.Repeat([]byte{' '}, nativemsg.DefaultMaxIncoming+1)
+		var lenBuf [4]byte
+		binary.LittleEndian.PutUint32(lenBuf[:], uint32(len(body)))
+		w.Write(lenBuf[:])
+		w.Write(body)
+		w.Write(frame(`{"type":"updated","tabs":[{"id":3,"title":"After","host":"example.com"}]}`))
+	}()
 
-	if _, err := w.Write(lenBuf[:]); err != nil {
-		t.Fatalf("Failed to write length header: %v", err)
+	// The oversized message is reported, not fatal
+	select {
+	case got := <-evCh:
+		if _, ok := got.(protocol.DroppedEvent); !ok {
+			t.Fatalf("Expected DroppedEvent for oversized message, got %T", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for DroppedEvent")
 	}
 
-	// Give the goroutine time to process and reject the message
-	time.Sleep(100 * time.Millisecond)
-
-	// The receiver should have exited due to oversized message
-	// Channel should be empty
 	select {
 	case got := <-evCh:
-		t.Fatalf("Expected no event due to oversized message, got %T", got)
-	default:
-		// Expected: no event received
+		if e, ok := got.(protocol.UpdatedEvent); !ok || len(e.Tabs) != 1 || e.Tabs[0].ID != 3 {
+			t.Fatalf("Expected UpdatedEvent after oversized message, got %#v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for event after oversized message")
 	}
 }
 
@@ -149,7 +160,7 @@ func TestStartEventReceiver_InvalidJSON(t *testing.T) {
 	evCh := make(chan protocol.Event, 1)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Write invalid JSON
 	invalidJSON := []byte("not valid json")
@@ -164,15 +175,14 @@ func TestStartEventReceiver_InvalidJSON(t *testing.T) {
 		t.Fatalf("Failed to write invalid JSON: %v", err)
 	}
 
-	// Give the goroutine time to process the invalid message
-	time.Sleep(100 * time.Millisecond)
-
-	// The receiver should continue running and not send an event
+	// The receiver should report the message as dropped and continue
 	select {
 	case got := <-evCh:
-		t.Fatalf("Expected no event due to invalid JSON, got %T", got)
-	default:
-		// Expected: no event received
+		if _, ok := got.(protocol.DroppedEvent); !ok {
+			t.Fatalf("Expected DroppedEvent for invalid JSON, got %T", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for DroppedEvent")
 	}
 
 	// Now send a valid event to verify the receiver is still running
@@ -230,7 +240,7 @@ func TestStartEventReceiver_PartialRead(t *testing.T) {
 	evCh := make(chan protocol.Event, 1)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Write partial length header
 	if _, err := w.Write([]byte{0x01, 0x02}); err != nil {
@@ -265,7 +275,7 @@ func TestStartEventReceiver_MultipleEvents(t *testing.T) {
 	evCh := make(chan protocol.Event, 10)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Send multiple events
 	for i := 1; i <= 3; i++ {
@@ -328,7 +338,7 @@ func TestStartEventReceiver_EmptyMessage(t *testing.T) {
 	evCh := make(chan protocol.Event, 1)
 
 	// Start the event receiver
-	Start(r, evCh)
+	Start(t.Context(), r, evCh, slog.Default(), metrics.New())
 
 	// Write a zero-length message
 	length := uint32(0)
@@ -339,14 +349,41 @@ func TestStartEventReceiver_EmptyMessage(t *testing.T) {
 		t.Fatalf("Failed to write length header: %v", err)
 	}
 
-	// Give the goroutine time to process
-	time.Sleep(100 * time.Millisecond)
-
-	// Should not receive any event (empty message can't be parsed)
+	// An empty message can't be parsed and is reported as dropped
 	select {
 	case got := <-evCh:
-		t.Fatalf("Expected no event for empty message, got %T", got)
-	default:
-		// Expected: no event received
+		if _, ok := got.(protocol.DroppedEvent); !ok {
+			t.Fatalf("Expected DroppedEvent for empty message, got %T", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timeout waiting for DroppedEvent")
+	}
+}
+
+func TestStartEventReceiver_UnknownEventIgnored(t *testing.T) {
+	input := append(frame(`{"type":"fromTheFuture"}`), frame(`{"type":"updated","tabs":[]}`)...)
+	evCh := make(chan protocol.Event, 2)
+	<-Start(t.Context(), bytes.NewReader(input), evCh, slog.Default(), metrics.New())
+
+	if got := <-evCh; got.Type() != "updated" {
+		t.Errorf("Expected the unknown event to be skipped, got %T", got)
+	}
+	if len(evCh) != 0 {
+		t.Errorf("Expected one event, got %d more", len(evCh))
+	}
+}
+
+func TestStartEventReceiver_StopsWhenNobodyReceives(t *testing.T) {
+	input := append(frame(`{"type":"updated","tabs":[]}`), frame(`{"type":"updated","tabs":[]}`)...)
+	ctx, cancel := context.WithCancel(t.Context())
+	evCh := make(chan protocol.Event)
+	done := Start(ctx, bytes.NewReader(input), evCh, slog.Default(), metrics.New())
+
+	// Nobody reads the events any more; the receiver must not block on them
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("receiver still blocked on sending after cancel")
 	}
 }
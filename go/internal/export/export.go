@@ -0,0 +1,158 @@
+// Package export writes tabs as link lists for pasting into documents, with a
+// heading per window and per tab group.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"strconv"
+	"strings"
+
+	"rofi-chrome-tab/internal/session"
+)
+
+// section is a run of tabs under one heading: a window, or a group in it.
+type section struct {
+	window  int
+	groupID int
+	group   string
+	tabs    []session.Tab
+}
+
+// sections splits the windows of s into runs of ungrouped tabs and of tabs of
+// the same group. Windows are numbered from 1.
+func sections(s session.Session) []section {
+	var out []section
+	for i, w := range s.Windows {
+		titles := map[int]string{}
+		for _, g := range w.Groups {
+			titles[g.ID] = strings.Join(strings.Fields(g.Title), " ")
+			if titles[g.ID] == "" {
+				titles[g.ID] = "Unnamed group"
+			}
+		}
+		for _, tab := range w.Tabs {
+			if len(out) == 0 || out[len(out)-1].window != i+1 || out[len(out)-1].groupID != tab.GroupID {
+				out = append(out, section{window: i + 1, groupID: tab.GroupID, group: titles[tab.GroupID]})
+			}
+			last := &out[len(out)-1]
+			last.tabs = append(last.tabs, tab)
+		}
+	}
+	return out
+}
+
+// title is the link text of a tab, its URL for tabs without a title.
+func title(tab session.Tab) string {
+	t := strings.Join(strings.Fields(tab.Title), " ")
+	if t == "" {
+		return tab.URL
+	}
+	return t
+}
+
+// Write writes the tabs of s in format.
+func Write(w io.Writer, format string, s session.Session) error {
+	writer := bufio.NewWriter(w)
+	var err error
+	switch format {
+	case "markdown":
+		writeMarkdown(writer, sections(s))
+	case "html":
+		writeHTML(writer, sections(s))
+	case "csv":
+		err = writeCSV(writer, sections(s))
+	case "onetab":
+		writeOneTab(writer, sections(s))
+	case "urls":
+		for _, sec := range sections(s) {
+			for _, tab := range sec.tabs {
+				fmt.Fprintln(writer, tab.URL)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown export format: %s", format)
+	}
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+var (
+	markdownText = strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`)
+	markdownURL  = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+)
+
+func writeMarkdown(w io.Writer, secs []section) {
+	window := 0
+	for _, sec := range secs {
+		if sec.window != window {
+			window = sec.window
+			fmt.Fprintf(w, "## Window %d\n\n", window)
+		}
+		if sec.group != "" {
+			fmt.Fprintf(w, "### %s\n\n", markdownText.Replace(sec.group))
+		}
+		for _, tab := range sec.tabs {
+			fmt.Fprintf(w, "- [%s](%s)\n", markdownText.Replace(title(tab)), markdownURL.Replace(tab.URL))
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+func writeHTML(w io.Writer, secs []section) {
+	window := 0
+	for _, sec := range secs {
+		if sec.window != window {
+			window = sec.window
+			fmt.Fprintf(w, "<h2>Window %d</h2>\n", window)
+		}
+		if sec.group != "" {
+			fmt.Fprintf(w, "<h3>%s</h3>\n", html.EscapeString(sec.group))
+		}
+		fmt.Fprintln(w, "<ul>")
+		for _, tab := range sec.tabs {
+			fmt.Fprintf(w, "<li><a href=\"%s\">%s</a></li>\n", html.EscapeString(tab.URL), html.EscapeString(title(tab)))
+		}
+		fmt.Fprintln(w, "</ul>")
+	}
+}
+
+// csvCell keeps a spreadsheet from taking text for a formula: titles come
+// from any site, so a leading '=', '+', '-' or '@' is escaped with a quote.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// writeCSV writes one record per tab; the headings become columns.
+func writeCSV(w io.Writer, secs []section) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"window", "group", "title", "url"})
+	for _, sec := range secs {
+		for _, tab := range sec.tabs {
+			cw.Write([]string{strconv.Itoa(sec.window), csvCell(sec.group), csvCell(title(tab)), csvCell(tab.URL)})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeOneTab writes the OneTab import format: "URL | title" lines, with a
+// blank line between groups. It has no headings.
+func writeOneTab(w io.Writer, secs []section) {
+	for i, sec := range secs {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		for _, tab := range sec.tabs {
+			fmt.Fprintf(w, "%s | %s\n", tab.URL, title(tab))
+		}
+	}
+}
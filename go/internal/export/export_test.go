@@ -0,0 +1,136 @@
+package export
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"rofi-chrome-tab/internal/session"
+)
+
+var s = session.Session{Name: "export", Windows: []session.Window{
+	{
+		Tabs: []session.Tab{
+			{URL: "https://mail.test/", Title: "Mail", Pinned: true},
+			{URL: "https://docs.test/a_(b)", Title: "Docs [draft]", GroupID: 7},
+			{URL: "https://ci.test/?a=1&b=2", Title: "<CI>", GroupID: 7},
+			{URL: "https://blank.test/"},
+		},
+		Groups: []session.Group{{ID: 7, Title: "Project"}},
+	},
+	{Tabs: []session.Tab{{URL: "https://news.test/", Title: "News,\nToday"}}},
+}}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"markdown", `## Window 1
+
+- [Mail](https://mail.test/)
+
+### Project
+
+- [Docs \[draft\]](https://docs.test/a_%28b%29)
+- [<CI>](https://ci.test/?a=1&b=2)
+
+- [https://blank.test/](https://blank.test/)
+
+## Window 2
+
+- [News, Today](https://news.test/)
+
+`},
+		{"html", `<h2>Window 1</h2>
+<ul>
+<li><a href="https://mail.test/">Mail</a></li>
+</ul>
+<h3>Project</h3>
+<ul>
+<li><a href="https://docs.test/a_(b)">Docs [draft]</a></li>
+<li><a href="https://ci.test/?a=1&amp;b=2">&lt;CI&gt;</a></li>
+</ul>
+<ul>
+<li><a href="https://blank.test/">https://blank.test/</a></li>
+</ul>
+<h2>Window 2</h2>
+<ul>
+<li><a href="https://news.test/">News, Today</a></li>
+</ul>
+`},
+		{"csv", `window,group,title,url
+1,,Mail,https://mail.test/
+1,Project,Docs [draft],https://docs.test/a_(b)
+1,Project,<CI>,https://ci.test/?a=1&b=2
+1,,https://blank.test/,https://blank.test/
+2,,"News, Today",https://news.test/
+`},
+		{"onetab", `https://mail.test/ | Mail
+
+https://docs.test/a_(b) | Docs [draft]
+https://ci.test/?a=1&b=2 | <CI>
+
+https://blank.test/ | https://blank.test/
+
+https://news.test/ | News, Today
+`},
+		{"urls", `https://mail.test/
+https://docs.test/a_(b)
+https://ci.test/?a=1&b=2
+https://blank.test/
+https://news.test/
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tt.format, s); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Write() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteUnknownFormat(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, "pdf", s); err == nil || buf.Len() != 0 {
+		t.Errorf("Write(pdf) = %v, wrote %q", err, buf.String())
+	}
+}
+
+func TestWriteUntrustedTitles(t *testing.T) {
+	s := session.Session{Windows: []session.Window{{
+		Tabs: []session.Tab{
+			{URL: "https://calc.test/", Title: "=HYPERLINK(\"https://evil.test/\")", GroupID: 3},
+			{URL: "https://shop.test/", Title: "-10% today", GroupID: 3},
+			{URL: "https://chat.test/", Title: "@channel"},
+		},
+		Groups: []session.Group{{ID: 3, Title: "+Sales\nQ3"}},
+	}}}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "csv", s); err != nil {
+		t.Fatal(err)
+	}
+	want := `window,group,title,url
+1,'+Sales Q3,"'=HYPERLINK(""https://evil.test/"")",https://calc.test/
+1,'+Sales Q3,'-10% today,https://shop.test/
+1,,'@channel,https://chat.test/
+`
+	if got := buf.String(); got != want {
+		t.Errorf("csv =\n%s\nwant\n%s", got, want)
+	}
+
+	// A line break in a group title does not end its heading
+	buf.Reset()
+	if err := Write(&buf, "markdown", s); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); !strings.Contains(got, "### +Sales Q3\n\n- ") {
+		t.Errorf("markdown =\n%s", got)
+	}
+}
@@ -0,0 +1,110 @@
+// Package favicon keeps site icons on disk, one PNG per host, so that rofi
+// can show them next to tabs. Icons arrive from the extension as data: URLs
+// in whatever format the site uses; PNG, GIF, JPEG and ICO are understood.
+package favicon
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	// Formats sites use for icons besides PNG and ICO
+	_ "image/gif"
+	_ "image/jpeg"
+
+	"rofi-chrome-tab/internal/dataurl"
+)
+
+// MaxSize bounds the width and height of an icon, so that a page cannot make
+// the host decode a huge image.
+const MaxSize = 512
+
+// validHost matches the host names an icon may be stored under. Anything
+// else, such as IPv6 addresses or the redaction placeholder, has no icon.
+var validHost = regexp.MustCompile(`^[a-z0-9_-][a-z0-9._-]*$`)
+
+// Cache keeps icons in a directory, named after their host.
+type Cache struct {
+	Dir string
+}
+
+func (c Cache) path(host string) (string, bool) {
+	if len(host) > 253 || !validHost.MatchString(host) {
+		return "", false
+	}
+	return filepath.Join(c.Dir, host+".png"), true
+}
+
+// Lookup returns the file of the icon of host, or "" if there is none.
+func (c Cache) Lookup(host string) string {
+	p, ok := c.path(host)
+	if !ok {
+		return ""
+	}
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+// Store converts the icon in dataURL to PNG and saves it as the icon of host,
+// replacing any older one. It returns the file written.
+func (c Cache) Store(host, dataURL string) (string, error) {
+	p, ok := c.path(host)
+	if !ok {
+		return "", fmt.Errorf("invalid host %q", host)
+	}
+	img, err := Decode(dataURL)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return "", err
+	}
+	// Hosts serving other browsers may store the same icon at once
+	tmp, err := os.CreateTemp(c.Dir, host+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0600); err != nil {
+		return "", err
+	}
+	return p, os.Rename(tmp.Name(), p)
+}
+
+// Decode decodes the image in a data: URL. The format is detected from the
+// data rather than trusted from the media type.
+func Decode(dataURL string) (image.Image, error) {
+	data, err := dataurl.Decode(dataURL)
+	if err != nil {
+		return nil, err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("unsupported icon: %w", err)
+	}
+	if cfg.Width > MaxSize || cfg.Height > MaxSize {
+		return nil, fmt.Errorf("%s icon of %dx%d is larger than %dx%d", format, cfg.Width, cfg.Height, MaxSize, MaxSize)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s icon: %w", format, err)
+	}
+	return img, nil
+}
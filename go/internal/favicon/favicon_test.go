@@ -0,0 +1,205 @@
+package favicon
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var red = color.NRGBA{R: 0xff, A: 0xff}
+
+func square(size int, c color.Color) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, size, size))
+	for y := range size {
+		for x := range size {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func dataURL(mime string, data []byte) string {
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+func encodePNG(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// ico wraps images, given as PNG or bitmap data, in an ICO directory.
+func ico(sizes []int, images ...[]byte) []byte {
+	var buf bytes.Buffer
+	le := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	le([]uint16{0, 1, uint16(len(images))})
+	offset := 6 + 16*len(images)
+	for i, img := range images {
+		buf.Write([]byte{byte(sizes[i]), byte(sizes[i]), 0, 0})
+		le([]uint16{1, 32})
+		le([]uint32{uint32(len(img)), uint32(offset)})
+		offset += len(img)
+	}
+	for _, img := range images {
+		buf.Write(img)
+	}
+	return buf.Bytes()
+}
+
+// dib encodes a bitmap as stored in ICO files, bottom row first, with an AND
+// mask marking the left column transparent.
+func dib(size, bitCount int, pixel func(x, y int) []byte) []byte {
+	var buf bytes.Buffer
+	le := func(v any) { binary.Write(&buf, binary.LittleEndian, v) }
+	le([]uint32{40, uint32(size), uint32(2 * size)})
+	le([]uint16{1, uint16(bitCount)})
+	le([]uint32{0, 0, 0, 0, 0, 0})
+	if bitCount == 1 {
+		// Palette: black and red
+		buf.Write([]byte{0, 0, 0, 0, 0, 0, 0xff, 0})
+	}
+	stride := (size*bitCount + 31) / 32 * 4
+	for y := size - 1; y >= 0; y-- {
+		row := make([]byte, 0, stride)
+		if bitCount == 1 {
+			row = append(row, pixel(0, y)...)
+		} else {
+			for x := range size {
+				row = append(row, pixel(x, y)...)
+			}
+		}
+		buf.Write(row[:cap(row)])
+	}
+	maskStride := (size + 31) / 32 * 4
+	for range size {
+		row := make([]byte, maskStride)
+		row[0] = 0x80
+		buf.Write(row)
+	}
+	return buf.Bytes()
+}
+
+func TestDecode(t *testing.T) {
+	var gifData bytes.Buffer
+	if err := gif.Encode(&gifData, square(16, red), nil); err != nil {
+		t.Fatal(err)
+	}
+	bgr := func(x, y int) []byte { return []byte{0, 0, 0xff} }
+	bgra := func(x, y int) []byte { return []byte{0, 0, 0xff, 0xff} }
+	bgraNoAlpha := func(x, y int) []byte { return []byte{0, 0, 0xff, 0} }
+	bits := func(x, y int) []byte { return []byte{0xff, 0xff, 0, 0} }
+
+	tests := []struct {
+		name string
+		url  string
+		size int
+		// transparent is set for icons whose left column is masked out
+		transparent bool
+	}{
+		{"png", dataURL("image/png", encodePNG(t, square(16, red))), 16, false},
+		{"gif", dataURL("image/gif", gifData.Bytes()), 16, false},
+		{"mislabelled", dataURL("image/x-icon", encodePNG(t, square(16, red))), 16, false},
+		{"ico with png", dataURL("image/x-icon", ico([]int{16, 32},
+			encodePNG(t, square(16, color.Black)), encodePNG(t, square(32, red)))), 32, false},
+		{"ico 32-bit", dataURL("image/x-icon", ico([]int{16}, dib(16, 32, bgra))), 16, false},
+		{"ico 32-bit with mask only", dataURL("image/x-icon", ico([]int{16}, dib(16, 32, bgraNoAlpha))), 16, true},
+		{"ico 24-bit", dataURL("image/vnd.microsoft.icon", ico([]int{16}, dib(16, 24, bgr))), 16, true},
+		{"ico 1-bit", dataURL("image/x-icon", ico([]int{16}, dib(16, 1, bits))), 16, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Decode(tt.url)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			if b := img.Bounds(); b.Dx() != tt.size || b.Dy() != tt.size {
+				t.Fatalf("size = %v, want %d", b, tt.size)
+			}
+			if got := color.NRGBAModel.Convert(img.At(tt.size-1, 0)); got != red {
+				t.Errorf("pixel = %v, want red", got)
+			}
+			_, _, _, a := img.At(0, tt.size-1).RGBA()
+			if tt.transparent != (a == 0) {
+				t.Errorf("left column alpha = %d", a)
+			}
+		})
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"not data", "https://example.com/favicon.ico", "not a data: URL"},
+		{"svg", "data:image/svg+xml,%3Csvg%20xmlns%3D%22http%3A%2F%2Fwww.w3.org%2F2000%2Fsvg%22%2F%3E", "unsupported icon"},
+		{"too large", dataURL("image/png", encodePNG(t, square(MaxSize+1, red))), "larger than"},
+		{"truncated ico", dataURL("image/x-icon", ico([]int{16}, encodePNG(t, square(16, red)))[:30]), "outside the file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(tt.url)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := Cache{Dir: filepath.Join(t.TempDir(), "favicons")}
+	if got := c.Lookup("example.com"); got != "" {
+		t.Errorf("Lookup() before Store = %q", got)
+	}
+
+	p, err := c.Store("example.com", dataURL("image/png", encodePNG(t, square(16, red))))
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if p != filepath.Join(c.Dir, "example.com.png") {
+		t.Errorf("Store() = %q", p)
+	}
+	if got := c.Lookup("example.com"); got != p {
+		t.Errorf("Lookup() = %q, want %q", got, p)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := png.Decode(f); err != nil {
+		t.Errorf("cached icon is not a PNG: %v", err)
+	}
+	if entries, _ := os.ReadDir(c.Dir); len(entries) != 1 {
+		t.Errorf("cache holds %d files, want 1", len(entries))
+	}
+
+	// A failed store keeps the old icon
+	if _, err := c.Store("example.com", "data:image/png;base64,AAAA"); err == nil {
+		t.Error("Store() of garbage succeeded")
+	}
+	if got := c.Lookup("example.com"); got != p {
+		t.Errorf("Lookup() after failed Store = %q", got)
+	}
+
+	for _, host := range []string{"", "..", "../etc", "[redacted]", "::1", "Example.com"} {
+		if _, err := c.Store(host, dataURL("image/png", encodePNG(t, square(16, red)))); err == nil {
+			t.Errorf("Store(%q) succeeded", host)
+		}
+		if got := c.Lookup(host); got != "" {
+			t.Errorf("Lookup(%q) = %q", host, got)
+		}
+	}
+}
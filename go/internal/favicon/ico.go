@@ -0,0 +1,183 @@
+package favicon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// ICO files hold several sizes of an icon, each a PNG or a headerless BMP
+// with a transparency mask below the colours. The largest is decoded.
+
+func init() {
+	image.RegisterFormat("ico", "\x00\x00\x01\x00", decodeICO, decodeICOConfig)
+}
+
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+type icoEntry struct {
+	width, height int
+	bitCount      int
+	size, offset  uint32
+}
+
+// readICO reads the directory of an ICO file and returns its largest entry
+// and the whole file.
+func readICO(r io.Reader) (icoEntry, []byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return icoEntry{}, nil, err
+	}
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return icoEntry{}, nil, errors.New("ico: invalid header")
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+16*count {
+		return icoEntry{}, nil, errors.New("ico: invalid directory")
+	}
+	var best icoEntry
+	for i := range count {
+		d := data[6+16*i:]
+		e := icoEntry{
+			width:    int(d[0]),
+			height:   int(d[1]),
+			bitCount: int(binary.LittleEndian.Uint16(d[6:])),
+			size:     binary.LittleEndian.Uint32(d[8:]),
+			offset:   binary.LittleEndian.Uint32(d[12:]),
+		}
+		// 0 stands for 256
+		if e.width == 0 {
+			e.width = 256
+		}
+		if e.height == 0 {
+			e.height = 256
+		}
+		if e.width > best.width || e.width == best.width && e.bitCount > best.bitCount {
+			best = e
+		}
+	}
+	if uint64(best.offset)+uint64(best.size) > uint64(len(data)) {
+		return icoEntry{}, nil, errors.New("ico: image outside the file")
+	}
+	return best, data, nil
+}
+
+func decodeICOConfig(r io.Reader) (image.Config, error) {
+	e, _, err := readICO(r)
+	if err != nil {
+		return image.Config{}, err
+	}
+	return image.Config{ColorModel: color.NRGBAModel, Width: e.width, Height: e.height}, nil
+}
+
+func decodeICO(r io.Reader) (image.Image, error) {
+	e, data, err := readICO(r)
+	if err != nil {
+		return nil, err
+	}
+	img := data[e.offset : e.offset+e.size]
+	if bytes.HasPrefix(img, pngMagic) {
+		return png.Decode(bytes.NewReader(img))
+	}
+	return decodeDIB(img)
+}
+
+// decodeDIB decodes a BMP without file header as stored in ICO files: the
+// height covers the colours and the AND mask, rows go bottom up and are
+// padded to four bytes.
+func decodeDIB(b []byte) (image.Image, error) {
+	if len(b) < 40 {
+		return nil, errors.New("ico: short bitmap header")
+	}
+	headerSize := binary.LittleEndian.Uint32(b[0:])
+	width := int(int32(binary.LittleEndian.Uint32(b[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(b[8:]))) / 2
+	bitCount := int(binary.LittleEndian.Uint16(b[14:]))
+	compression := binary.LittleEndian.Uint32(b[16:])
+	colorsUsed := int(binary.LittleEndian.Uint32(b[32:]))
+	if width <= 0 || height <= 0 || width > MaxSize || height > MaxSize {
+		return nil, fmt.Errorf("ico: invalid bitmap size %dx%d", width, height)
+	}
+	if compression != 0 || headerSize < 40 || uint64(headerSize) > uint64(len(b)) {
+		return nil, errors.New("ico: unsupported bitmap")
+	}
+
+	var palette []color.NRGBA
+	switch bitCount {
+	case 1, 4, 8:
+		n := colorsUsed
+		if n == 0 || n > 1<<bitCount {
+			n = 1 << bitCount
+		}
+		p := b[headerSize:]
+		if len(p) < 4*n {
+			return nil, errors.New("ico: short palette")
+		}
+		palette = make([]color.NRGBA, n)
+		for i := range palette {
+			palette[i] = color.NRGBA{R: p[4*i+2], G: p[4*i+1], B: p[4*i], A: 0xff}
+		}
+	case 24, 32:
+	default:
+		return nil, fmt.Errorf("ico: unsupported bit count %d", bitCount)
+	}
+
+	pixels := b[int(headerSize)+4*len(palette):]
+	stride := (width*bitCount + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if len(pixels) < stride*height {
+		return nil, errors.New("ico: short bitmap")
+	}
+	mask := pixels[stride*height:]
+	if len(mask) < maskStride*height {
+		// Some 32-bit icons leave out the mask and rely on alpha alone
+		mask = nil
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	hasAlpha := false
+	for y := range height {
+		row := pixels[(height-1-y)*stride:]
+		for x := range width {
+			var c color.NRGBA
+			switch bitCount {
+			case 32:
+				c = color.NRGBA{R: row[4*x+2], G: row[4*x+1], B: row[4*x], A: row[4*x+3]}
+				hasAlpha = hasAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{R: row[3*x+2], G: row[3*x+1], B: row[3*x], A: 0xff}
+			default:
+				bit := x * bitCount
+				i := int(row[bit/8]>>(8-bitCount-bit%8)) & (1<<bitCount - 1)
+				if i >= len(palette) {
+					return nil, errors.New("ico: colour outside the palette")
+				}
+				c = palette[i]
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+	if bitCount == 32 && hasAlpha || mask == nil {
+		return img, nil
+	}
+	for y := range height {
+		row := mask[(height-1-y)*maskStride:]
+		for x := range width {
+			if row[x/8]&(0x80>>(x%8)) != 0 {
+				img.SetNRGBA(x, y, color.NRGBA{})
+			} else if bitCount == 32 {
+				// An icon with a mask but no alpha is opaque where the mask
+				// says so
+				c := img.NRGBAAt(x, y)
+				c.A = 0xff
+				img.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return img, nil
+}
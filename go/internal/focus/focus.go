@@ -0,0 +1,32 @@
+package focus
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// Command returns the window manager command that raises the browser window
+// after a tab has been selected, or nil for the "none" backend.
+func Command(backend string) (*exec.Cmd, error) {
+	switch backend {
+	case "i3":
+		return exec.Command("i3-msg", "[urgent=latest] focus"), nil
+	case "sway":
+		return exec.Command("swaymsg", "[urgent=latest] focus"), nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown focus backend: %s", backend)
+	}
+}
+
+func Focus(backend string) error {
+	cmd, err := Command(backend)
+	if err != nil || cmd == nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %v: %s", cmd.Path, err, out)
+	}
+	return nil
+}
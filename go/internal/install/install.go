@@ -0,0 +1,194 @@
+package install
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// HostName is the native messaging host name the extension connects to.
+const HostName = "rofi_chrome_tab"
+
+// Browser is a Chromium-based browser and where it looks for native
+// messaging host manifests.
+type Browser struct {
+	Name string
+	// UserDir is relative to $XDG_CONFIG_HOME.
+	UserDir   string
+	SystemDir string
+}
+
+var Browsers = []Browser{
+	{"chrome", "google-chrome/NativeMessagingHosts", "/etc/opt/chrome/native-messaging-hosts"},
+	{"chromium", "chromium/NativeMessagingHosts", "/etc/chromium/native-messaging-hosts"},
+	{"brave", "BraveSoftware/Brave-Browser/NativeMessagingHosts", "/etc/opt/brave.com/brave/native-messaging-hosts"},
+	{"edge", "microsoft-edge/NativeMessagingHosts", "/etc/opt/edge/native-messaging-hosts"},
+	{"vivaldi", "vivaldi/NativeMessagingHosts", "/etc/opt/vivaldi/native-messaging-hosts"},
+}
+
+// BrowserNames returns the names accepted by Lookup, besides "all".
+func BrowserNames() []string {
+	names := make([]string, len(Browsers))
+	for i, b := range Browsers {
+		names[i] = b.Name
+	}
+	return names
+}
+
+// Lookup returns the browser with the given name, or every browser for "all".
+func Lookup(name string) ([]Browser, error) {
+	if name == "all" {
+		return Browsers, nil
+	}
+	for _, b := range Browsers {
+		if b.Name == name {
+			return []Browser{b}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown browser %q (want one of %s, all)", name, strings.Join(BrowserNames(), ", "))
+}
+
+// Dir returns the manifest directory of b.
+func (b Browser) Dir(system bool, configHome string) string {
+	if system {
+		return b.SystemDir
+	}
+	return filepath.Join(configHome, b.UserDir)
+}
+
+// ManifestPath returns the manifest file of b.
+func (b Browser) ManifestPath(system bool, configHome string) string {
+	return filepath.Join(b.Dir(system, configHome), HostName+".json")
+}
+
+type Manifest struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	Path           string   `json:"path"`
+	Type           string   `json:"type"`
+	AllowedOrigins []string `json:"allowed_origins"`
+}
+
+var extensionIDPattern = regexp.MustCompile(`^[a-p]{32}$`)
+
+// ValidExtensionID reports whether id looks like a Chrome extension ID.
+func ValidExtensionID(id string) bool {
+	return extensionIDPattern.MatchString(id)
+}
+
+// Origin returns the allowed origin of an extension ID.
+func Origin(id string) string {
+	return "chrome-extension://" + id + "/"
+}
+
+// NewManifest returns the manifest for the host binary at exe, allowing the
+// given extensions.
+func NewManifest(exe string, extensionIDs []string) (Manifest, error) {
+	if !filepath.IsAbs(exe) {
+		return Manifest{}, fmt.Errorf("host path must be absolute: %s", exe)
+	}
+	if len(extensionIDs) == 0 {
+		return Manifest{}, errors.New("at least one extension ID is required")
+	}
+	m := Manifest{
+		Name:        HostName,
+		Description: "A chrome extension to select tabs from rofi window switcher",
+		Path:        exe,
+		Type:        "stdio",
+	}
+	for _, id := range extensionIDs {
+		if !ValidExtensionID(id) {
+			return Manifest{}, fmt.Errorf("invalid extension ID %q (want 32 letters a-p)", id)
+		}
+		m.AllowedOrigins = append(m.AllowedOrigins, Origin(id))
+	}
+	return m, nil
+}
+
+// Options control Install and Uninstall.
+type Options struct {
+	Browsers   []Browser
+	System     bool
+	DryRun     bool
+	ConfigHome string
+}
+
+// Install writes m for every browser in opts, reporting each file on out.
+func Install(m Manifest, opts Options, out io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	var errs []error
+	for _, b := range opts.Browsers {
+		p := b.ManifestPath(opts.System, opts.ConfigHome)
+		if opts.DryRun {
+			fmt.Fprintf(out, "would write %s\n", p)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			continue
+		}
+		if err := os.WriteFile(p, data, 0644); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			continue
+		}
+		fmt.Fprintf(out, "wrote %s\n", p)
+	}
+	if opts.DryRun {
+		fmt.Fprintf(out, "%s", data)
+	}
+	return errors.Join(errs...)
+}
+
+// Uninstall removes the manifest of every browser in opts. Missing manifests
+// are skipped.
+func Uninstall(opts Options, out io.Writer) error {
+	var errs []error
+	for _, b := range opts.Browsers {
+		p := b.ManifestPath(opts.System, opts.ConfigHome)
+		if _, err := os.Stat(p); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if opts.DryRun {
+			fmt.Fprintf(out, "would remove %s\n", p)
+			continue
+		}
+		if err := os.Remove(p); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.Name, err))
+			continue
+		}
+		fmt.Fprintf(out, "removed %s\n", p)
+	}
+	return errors.Join(errs...)
+}
+
+// ConfigHome returns $XDG_CONFIG_HOME or its default.
+func ConfigHome() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config"), nil
+}
+
+// Executable returns the absolute path of the running binary with symlinks
+// resolved.
+func Executable() (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(exe)
+}
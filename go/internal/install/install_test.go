@@ -0,0 +1,106 @@
+package install
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testID = "abcdefghijklmnopabcdefghijklmnop"
+
+func TestNewManifest(t *testing.T) {
+	m, err := NewManifest("/usr/bin/rofi-chrome-tab", []string{testID})
+	if err != nil {
+		t.Fatalf("NewManifest() error = %v", err)
+	}
+	if m.Name != HostName || m.Type != "stdio" || m.AllowedOrigins[0] != "chrome-extension://"+testID+"/" {
+		t.Errorf("NewManifest() = %+v", m)
+	}
+
+	if _, err := NewManifest("rofi-chrome-tab", []string{testID}); err == nil {
+		t.Error("NewManifest() expected error for relative path")
+	}
+	if _, err := NewManifest("/usr/bin/rofi-chrome-tab", []string{"XYZ"}); err == nil {
+		t.Error("NewManifest() expected error for invalid extension ID")
+	}
+	if _, err := NewManifest("/usr/bin/rofi-chrome-tab", nil); err == nil {
+		t.Error("NewManifest() expected error without extension IDs")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	all, err := Lookup("all")
+	if err != nil || len(all) != len(Browsers) {
+		t.Errorf("Lookup(all) = %v, %v", all, err)
+	}
+	brave, err := Lookup("brave")
+	if err != nil || len(brave) != 1 || brave[0].Name != "brave" {
+		t.Errorf("Lookup(brave) = %v, %v", brave, err)
+	}
+	if _, err := Lookup("firefox"); err == nil {
+		t.Error("Lookup(firefox) expected error")
+	}
+}
+
+func TestInstallUninstall(t *testing.T) {
+	home := t.TempDir()
+	m, err := NewManifest("/usr/bin/rofi-chrome-tab", []string{testID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Browsers: Browsers, ConfigHome: home}
+
+	var out bytes.Buffer
+	if err := Install(m, opts, &out); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	p := filepath.Join(home, "BraveSoftware/Brave-Browser/NativeMessagingHosts/rofi_chrome_tab.json")
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatalf("manifest not written: %v", err)
+	}
+	var got Manifest
+	if err := json.Unmarshal(data, &got); err != nil || got.Path != m.Path {
+		t.Errorf("written manifest = %s, %v", data, err)
+	}
+	if strings.Count(out.String(), "wrote ") != len(Browsers) {
+		t.Errorf("Install() output = %q", out.String())
+	}
+
+	out.Reset()
+	opts.DryRun = true
+	if err := Uninstall(opts, &out); err != nil {
+		t.Fatalf("Uninstall(dry run) error = %v", err)
+	}
+	if _, err := os.Stat(p); err != nil {
+		t.Errorf("dry run removed %s", p)
+	}
+
+	opts.DryRun = false
+	if err := Uninstall(opts, &out); err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Errorf("manifest still present after Uninstall: %v", err)
+	}
+}
+
+func TestInstallDryRun(t *testing.T) {
+	home := t.TempDir()
+	m, _ := NewManifest("/usr/bin/rofi-chrome-tab", []string{testID})
+	chrome, _ := Lookup("chrome")
+
+	var out bytes.Buffer
+	if err := Install(m, Options{Browsers: chrome, ConfigHome: home, DryRun: true}, &out); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if !strings.Contains(out.String(), "would write "+filepath.Join(home, "google-chrome")) || !strings.Contains(out.String(), `"allowed_origins"`) {
+		t.Errorf("dry run output = %q", out.String())
+	}
+	if entries, _ := os.ReadDir(home); len(entries) != 0 {
+		t.Errorf("dry run created files: %v", entries)
+	}
+}
@@ -0,0 +1,154 @@
+// Package launch ranks open tabs, recently closed tabs, bookmarks and history
+// pages against a query, so that one launcher can switch to any of them.
+package launch
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Source is where an item comes from. Later sources win when two items have
+// the same URL.
+type Source int
+
+const (
+	History Source = iota
+	Bookmark
+	Closed
+	Tab
+)
+
+func (s Source) String() string {
+	switch s {
+	case History:
+		return "history"
+	case Bookmark:
+		return "bookmark"
+	case Closed:
+		return "closed"
+	case Tab:
+		return "tab"
+	default:
+		return "unknown"
+	}
+}
+
+// bonus favours going back to a page over opening it anew.
+var bonus = map[Source]float64{History: 0, Bookmark: 1, Closed: 1.5, Tab: 3}
+
+// Item is a launcher entry.
+type Item struct {
+	Source Source
+	// Command is the socket command that goes to the item.
+	Command string
+	Title   string
+	URL     string
+	// Time is when the page was last used: accessed, closed or visited.
+	Time   time.Time
+	Visits int
+	Score  float64
+}
+
+// Merge keeps one item per URL, the one from the winning source, with the
+// latest time and the highest visit count of all of them. Items without a
+// URL are kept as they are. The order of first appearance is kept.
+func Merge(items []Item) []Item {
+	var merged []Item
+	byURL := map[string]int{}
+	for _, item := range items {
+		if item.URL == "" {
+			merged = append(merged, item)
+			continue
+		}
+		i, ok := byURL[item.URL]
+		if !ok {
+			byURL[item.URL] = len(merged)
+			merged = append(merged, item)
+			continue
+		}
+		m := &merged[i]
+		winner := *m
+		if item.Source > m.Source {
+			winner = item
+		}
+		if item.Time.After(m.Time) {
+			winner.Time = item.Time
+		} else {
+			winner.Time = m.Time
+		}
+		winner.Visits = max(item.Visits, m.Visits)
+		*m = winner
+	}
+	return merged
+}
+
+// Rank scores the items matching query and returns them best first. Every
+// word of the query must occur in the title or URL; matches at the start of
+// a title word count most, then anywhere in the title, then in the URL.
+// Recent use, frequent visits and the source add to the score.
+func Rank(items []Item, query string, now time.Time) []Item {
+	words := strings.Fields(strings.ToLower(query))
+	var ranked []Item
+	for _, item := range items {
+		score, ok := match(words, strings.ToLower(item.Title), strings.ToLower(item.URL))
+		if !ok {
+			continue
+		}
+		if !item.Time.IsZero() {
+			// Halves every day
+			age := max(now.Sub(item.Time).Hours(), 0)
+			score += 4 * math.Exp2(-age/24)
+		}
+		score += math.Log1p(float64(item.Visits)) + bonus[item.Source]
+		item.Score = score
+		ranked = append(ranked, item)
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].Source > ranked[j].Source
+	})
+	return ranked
+}
+
+func match(words []string, title, url string) (float64, bool) {
+	score := 0.0
+	for _, w := range words {
+		if s := titleMatch(title, w); s > 0 {
+			score += s
+		} else if strings.Contains(url, w) {
+			score++
+		} else {
+			return 0, false
+		}
+	}
+	return score, true
+}
+
+// titleMatch scores w in title: 3 at the start of a word, 2 elsewhere and 0
+// if missing.
+func titleMatch(title, w string) float64 {
+	score := 0.0
+	for off := 0; ; {
+		i := strings.Index(title[off:], w)
+		if i < 0 {
+			return score
+		}
+		i += off
+		if i == 0 || isWordStart(title, i) {
+			return 3
+		}
+		score = 2
+		off = i + 1
+	}
+}
+
+// isWordStart reports whether s[i] follows a character that is not a letter
+// or digit.
+func isWordStart(s string, i int) bool {
+	c := s[i-1]
+	return !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c >= 0x80)
+}
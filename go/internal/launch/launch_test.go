@@ -0,0 +1,87 @@
+package launch
+
+import (
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func TestMerge(t *testing.T) {
+	items := Merge([]Item{
+		{Source: History, Command: "open https://go.dev/", URL: "https://go.dev/", Time: now, Visits: 9},
+		{Source: Bookmark, Command: "open-bookmark 3", URL: "https://go.dev/", Title: "Go"},
+		{Source: Tab, Command: "select 1", URL: "https://go.dev/", Title: "The Go Programming Language", Time: now.Add(-time.Hour)},
+		{Source: Closed, Command: "reopen 1", URL: "https://rust-lang.org/"},
+		{Source: Bookmark, Command: "open-bookmark 4", URL: "https://rust-lang.org/"},
+		{Source: Tab, Command: "select 2", Title: "New Tab"},
+	})
+	if len(items) != 3 {
+		t.Fatalf("Merge() = %+v", items)
+	}
+	want := Item{Source: Tab, Command: "select 1", URL: "https://go.dev/", Title: "The Go Programming Language", Time: now, Visits: 9}
+	if items[0] != want {
+		t.Errorf("merged go.dev = %+v, want %+v", items[0], want)
+	}
+	if items[1].Command != "reopen 1" || items[2].Command != "select 2" {
+		t.Errorf("Merge() = %+v", items)
+	}
+}
+
+func commands(items []Item) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, item.Command)
+	}
+	return out
+}
+
+func TestRank(t *testing.T) {
+	items := []Item{
+		{Source: History, Command: "h1", Title: "Django docs", URL: "https://djangoproject.com/", Time: now.Add(-48 * time.Hour), Visits: 2},
+		{Source: Tab, Command: "t1", Title: "Go docs", URL: "https://go.dev/doc/", Time: now.Add(-72 * time.Hour)},
+		{Source: Bookmark, Command: "b1", Title: "Algorithms", URL: "https://algo.test/go"},
+		{Source: History, Command: "h2", Title: "Weather", URL: "https://weather.test/"},
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		// Word start in the title beats a match inside a word or in the URL
+		{"go", []string{"t1", "h1", "b1"}},
+		{"GO DOC", []string{"t1", "h1"}},
+		{"docs", []string{"t1", "h1"}},
+		{"weather.test", []string{"h2"}},
+		{"missing", nil},
+	}
+	for _, tt := range tests {
+		got := commands(Rank(items, tt.query, now))
+		if len(got) != len(tt.want) {
+			t.Errorf("Rank(%q) = %v, want %v", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("Rank(%q) = %v, want %v", tt.query, got, tt.want)
+				break
+			}
+		}
+	}
+
+	// Without a query everything matches, recent and open first
+	if got := commands(Rank(items, "", now)); len(got) != 4 || got[0] != "t1" || got[3] != "h2" {
+		t.Errorf("Rank(\"\") = %v", got)
+	}
+}
+
+func TestRankRecency(t *testing.T) {
+	items := []Item{
+		{Source: History, Command: "old", Title: "Report", Time: now.Add(-30 * 24 * time.Hour)},
+		{Source: History, Command: "new", Title: "Report", Time: now.Add(-time.Hour)},
+	}
+	got := Rank(items, "report", now)
+	if got[0].Command != "new" || got[0].Score <= got[1].Score {
+		t.Errorf("Rank() = %+v", got)
+	}
+}
@@ -0,0 +1,166 @@
+package listfmt
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+	"unicode"
+)
+
+// Built-in row templates selected by the list.format setting.
+var Formats = map[string]string{
+	"csv": "{{.PID}},{{.ID}},{{.Host}},{{.Title}}",
+	"tsv": "{{.PID}}\t{{.ID}}\t{{.Host}}\t{{.Title}}",
+}
+
+// Row is the data available to a list template.
+type Row struct {
+	PID          int
+	Browser      string
+	Profile      string
+	ID           int
+	Host         string
+	Title        string
+	LastAccessed time.Time
+	// Stale is set when the host may have missed tab updates.
+	Stale bool
+	// Audible is set while the tab plays sound, even if Muted.
+	Audible bool
+	Muted   bool
+	// Icon is the file of the site's icon, or empty if none is cached.
+	Icon string
+	// Thumbnail is the file of a recent image of the tab, or empty.
+	Thumbnail string
+}
+
+type Template struct {
+	tmpl *template.Template
+	now  func() time.Time
+}
+
+// Parse compiles a row template. The trailing newline is added by Execute.
+func Parse(text string) (*Template, error) {
+	t := &Template{now: time.Now}
+	tmpl, err := template.New("row").Option("missingkey=error").Funcs(t.funcs()).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	t.tmpl = tmpl
+	return t, nil
+}
+
+// SetClock sets the time reltime measures against.
+func (t *Template) SetClock(now func() time.Time) {
+	t.now = now
+}
+
+// Execute writes one line per row.
+func (t *Template) Execute(w io.Writer, rows []Row) error {
+	for _, row := range rows {
+		if err := t.tmpl.Execute(w, row); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Template) funcs() template.FuncMap {
+	return template.FuncMap{
+		"trunc":   Truncate,
+		"pad":     Pad,
+		"pango":   EscapePango,
+		"icon":    Icon,
+		"reltime": func(tm time.Time) string { return RelTime(tm, t.now()) },
+	}
+}
+
+// Truncate shortens s to at most width columns, ending with an ellipsis when
+// anything was cut. It is written for pipelines: {{.Title | trunc 80}}.
+func Truncate(width int, s string) string {
+	if Width(s) <= width {
+		return s
+	}
+	if width <= 0 {
+		return ""
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		rw := RuneWidth(r)
+		if n+rw > width-1 {
+			break
+		}
+		b.WriteRune(r)
+		n += rw
+	}
+	b.WriteString("…")
+	return b.String()
+}
+
+// Pad right-pads s with spaces to width columns.
+func Pad(width int, s string) string {
+	if n := Width(s); n < width {
+		return s + strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// Sanitize replaces control characters in s with spaces. Tab titles come from
+// web pages; a newline would split a row and a NUL would start rofi row
+// options, so field values are sanitized before they reach a template.
+func Sanitize(s string) string {
+	if !strings.ContainsFunc(s, unicode.IsControl) {
+		return s
+	}
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+var pangoReplacer = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	"'", "&#39;",
+	`"`, "&quot;",
+)
+
+// EscapePango escapes s for rofi's markup-rows mode.
+func EscapePango(s string) string {
+	return pangoReplacer.Replace(s)
+}
+
+// Icon returns the rofi script-mode row option selecting an icon by name or
+// path. It must be the last thing in the row.
+func Icon(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "\x00icon\x1f" + name
+}
+
+// RelTime formats the age of tm relative to now, e.g. "5m ago".
+func RelTime(tm, now time.Time) string {
+	if tm.IsZero() {
+		return ""
+	}
+	d := now.Sub(tm)
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d/time.Minute))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dd ago", int(d/(24*time.Hour)))
+	}
+}
@@ -0,0 +1,98 @@
+package listfmt
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExecute(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	rows := []Row{
+		{PID: 7, ID: 1, Host: "example.com", Title: "A <b> & c", LastAccessed: now.Add(-5 * time.Minute)},
+		{PID: 7, ID: 2, Host: "例え.jp", Title: "Quite a long title", LastAccessed: now.Add(-3 * time.Hour)},
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"csv", Formats["csv"], "7,1,example.com,A <b> & c\n7,2,例え.jp,Quite a long title\n"},
+		{"pad and trunc", "{{.Host | pad 12}}|{{.Title | trunc 8}}", "example.com |A <b> &…\n例え.jp     |Quite a…\n"},
+		{"pango", "{{.Title | pango}}", "A &lt;b&gt; &amp; c\nQuite a long title\n"},
+		{"reltime", "{{.ID}} {{reltime .LastAccessed}}", "1 5m ago\n2 3h ago\n"},
+		{"icon", "{{.ID}}{{icon .Host}}", "1\x00icon\x1fexample.com\n2\x00icon\x1f例え.jp\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.text)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			tmpl.now = func() time.Time { return now }
+
+			var buf bytes.Buffer
+			if err := tmpl.Execute(&buf, rows); err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, text := range []string{"{{.Title", "{{.Title | nosuchfunc}}"} {
+		if _, err := Parse(text); err == nil {
+			t.Errorf("Parse(%q) expected error", text)
+		}
+	}
+}
+
+func TestExecuteUnknownField(t *testing.T) {
+	tmpl, err := Parse("{{.URL}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, []Row{{}}); err == nil {
+		t.Error("Execute() expected error for unknown field")
+	}
+}
+
+func TestWidth(t *testing.T) {
+	tests := []struct {
+		s    string
+		want int
+	}{
+		{"abc", 3},
+		{"日本語", 6},
+		{"é", 1},
+		{"🎵x", 3},
+	}
+	for _, tt := range tests {
+		if got := Width(tt.s); got != tt.want {
+			t.Errorf("Width(%q) = %d, want %d", tt.s, got, tt.want)
+		}
+	}
+}
+
+func TestSanitize(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{"plain", "plain"},
+		{"two\nlines", "two lines"},
+		{"a\r\n\tb", "a   b"},
+		{"title\x00icon\x1ffirefox", "title icon firefox"},
+		{"日本語\u0085", "日本語 "},
+	}
+	for _, tt := range tests {
+		if got := Sanitize(tt.s); got != tt.want {
+			t.Errorf("Sanitize(%q) = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package listfmt
+
+import "unicode"
+
+// wideRanges lists the code points rendered in two columns by terminal and
+// rofi fonts: CJK ideographs, Hangul, kana, fullwidth forms and most emoji.
+var wideRanges = []struct{ lo, hi rune }{
+	{0x1100, 0x115F},
+	{0x2E80, 0x303E},
+	{0x3041, 0x33FF},
+	{0x3400, 0x4DBF},
+	{0x4E00, 0x9FFF},
+	{0xA000, 0xA4CF},
+	{0xAC00, 0xD7A3},
+	{0xF900, 0xFAFF},
+	{0xFE30, 0xFE4F},
+	{0xFF00, 0xFF60},
+	{0xFFE0, 0xFFE6},
+	{0x1F300, 0x1F64F},
+	{0x1F900, 0x1F9FF},
+	{0x20000, 0x3FFFD},
+}
+
+// RuneWidth returns the number of columns r occupies.
+func RuneWidth(r rune) int {
+	if r == 0 || unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r) {
+		return 0
+	}
+	for _, w := range wideRanges {
+		if r >= w.lo && r <= w.hi {
+			return 2
+		}
+	}
+	return 1
+}
+
+// Width returns the number of columns s occupies.
+func Width(s string) int {
+	n := 0
+	for _, r := range s {
+		n += RuneWidth(r)
+	}
+	return n
+}
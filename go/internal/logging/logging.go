@@ -3,28 +3,70 @@ package logging
 import (
 	"fmt"
 	"io"
-	"log"
-	"os"
+	"log/slog"
+	"strings"
 
-	"rofi-chrome-tab/internal/debug"
+	"rofi-chrome-tab/internal/config"
 )
 
-type nopCloser struct{}
+// LevelOff is above every level that is ever logged.
+const LevelOff = slog.Level(100)
 
-func (nopCloser) Close() error { return nil }
+var level slog.LevelVar
 
-func SetupLogging(path string) (io.Closer, error) {
-	if debug.IsDebugMode() {
-		logFile, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to open log file:", err)
-			return nopCloser{}, err
-		}
-		log.SetOutput(logFile)
-		log.Println("Debug mode: logging to", path)
-		return logFile, err
+// SetupLogging installs the default slog logger writing to cfg.FilePath. The
+// returned Closer closes the log file.
+func SetupLogging(cfg config.LogConfig) (io.Closer, error) {
+	if err := SetLevel(cfg.Level); err != nil {
+		return nil, err
 	}
+	path, err := cfg.FilePath()
+	if err != nil {
+		return nil, err
+	}
+
+	out := newRotatingFile(path, int64(cfg.MaxSizeMB)*1024*1024, cfg.MaxBackups)
+	opts := &slog.HandlerOptions{Level: &level}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "json":
+		handler = slog.NewJSONHandler(out, opts)
+	case "text":
+		handler = slog.NewTextHandler(out, opts)
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", cfg.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+
+	slog.Info("logging started", "path", path, "level", cfg.Level, "format", cfg.Format)
+	return out, nil
+}
 
-	log.SetOutput(io.Discard)
-	return nopCloser{}, nil
+// SetLevel changes the minimum level at runtime. name is one of
+// config.LogLevels.
+func SetLevel(name string) error {
+	switch strings.ToLower(name) {
+	case "debug":
+		level.Set(slog.LevelDebug)
+	case "info":
+		level.Set(slog.LevelInfo)
+	case "warn":
+		level.Set(slog.LevelWarn)
+	case "error":
+		level.Set(slog.LevelError)
+	case "off":
+		level.Set(LevelOff)
+	default:
+		return fmt.Errorf("unknown log level: %s", name)
+	}
+	return nil
+}
+
+// Level returns the name of the current minimum level.
+func Level() string {
+	if level.Level() >= LevelOff {
+		return "off"
+	}
+	return strings.ToLower(level.Level().String())
 }
@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rofi-chrome-tab/internal/config"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.log")
+	r := newRotatingFile(path, 10, 2)
+	defer r.Close()
+
+	for _, line := range []string{"aaaaaaaa\n", "bbbbbbbb\n", "cccccccc\n", "dddddddd\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "dddddddd\n",
+		path + ".1": "cccccccc\n",
+		path + ".2": "bbbbbbbb\n",
+	}
+	for p, content := range want {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatalf("ReadFile(%s) error = %v", p, err)
+		}
+		if string(data) != content {
+			t.Errorf("%s = %q, want %q", p, data, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most 2 backups, stat .3 error = %v", err)
+	}
+}
+
+func TestRotatingFileOpensLazily(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host.log")
+	r := newRotatingFile(path, 0, 0)
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("log file created without any write")
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	defer SetLevel("off")
+
+	for _, name := range []string{"debug", "info", "warn", "error", "off"} {
+		if err := SetLevel(name); err != nil {
+			t.Fatalf("SetLevel(%q) error = %v", name, err)
+		}
+		if got := Level(); got != name {
+			t.Errorf("Level() = %q, want %q", got, name)
+		}
+	}
+	if err := SetLevel("trace"); err == nil || !strings.Contains(err.Error(), "trace") {
+		t.Errorf("SetLevel(trace) error = %v", err)
+	}
+}
+
+func TestSetupLoggingWithoutPath(t *testing.T) {
+	state := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", state)
+	defer slog.SetDefault(slog.Default())
+	defer SetLevel("off")
+
+	// Logging starts off; raising the level later writes to the state
+	// directory
+	closer, err := SetupLogging(config.LogConfig{Level: "off", Format: "text"})
+	if err != nil {
+		t.Fatalf("SetupLogging() error = %v", err)
+	}
+	defer closer.Close()
+	if err := SetLevel("debug"); err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("hello")
+
+	data, err := os.ReadFile(filepath.Join(state, "rofi-chrome-tab", "host.log"))
+	if err != nil || !strings.Contains(string(data), "hello") {
+		t.Errorf("log = %q, %v", data, err)
+	}
+}
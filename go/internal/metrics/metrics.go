@@ -0,0 +1,242 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds, in seconds, of the latency histograms.
+var LatencyBuckets = []float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// Registry collects the host's counters. It is safe for concurrent use.
+type Registry struct {
+	mu                sync.Mutex
+	started           time.Time
+	events            map[string]uint64
+	commands          map[string]uint64
+	commandErrors     map[string]uint64
+	parseErrors       map[string]uint64
+	oversized         uint64
+	connections       uint64
+	activeConnections int64
+	rejected          uint64
+	actions           map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64 // per bucket, plus +Inf
+	count  uint64
+	sum    float64
+}
+
+// Default is the registry used by the host.
+var Default = New()
+
+func New() *Registry {
+	return &Registry{
+		started:       time.Now(),
+		events:        map[string]uint64{},
+		commands:      map[string]uint64{},
+		commandErrors: map[string]uint64{},
+		parseErrors:   map[string]uint64{},
+		actions:       map[string]*histogram{},
+	}
+}
+
+func (r *Registry) EventReceived(typ string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events[typ]++
+}
+
+// CommandServed counts a command by name, and its failure if err is not nil.
+func (r *Registry) CommandServed(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.commands[name]++
+	if err != nil {
+		r.commandErrors[name]++
+	}
+}
+
+// ParseError counts a message that could not be parsed; source is "event" or
+// "command".
+func (r *Registry) ParseError(source string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.parseErrors[source]++
+}
+
+func (r *Registry) OversizedMessage() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.oversized++
+}
+
+func (r *Registry) ConnectionOpened() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.connections++
+	r.activeConnections++
+}
+
+// ConnectionRejected counts a connection turned away because too many were
+// open.
+func (r *Registry) ConnectionRejected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.rejected++
+}
+
+func (r *Registry) ConnectionClosed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.activeConnections--
+}
+
+// ObserveAction records how long sending an action to the extension took.
+func (r *Registry) ObserveAction(typ string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.actions[typ]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(LatencyBuckets)+1)}
+		r.actions[typ] = h
+	}
+	secs := d.Seconds()
+	i := sort.SearchFloat64s(LatencyBuckets, secs)
+	h.counts[i]++
+	h.count++
+	h.sum += secs
+}
+
+// Snapshot is a point-in-time copy of the registry, as served by the stats
+// command.
+type Snapshot struct {
+	UptimeSeconds       float64                    `json:"uptimeSeconds"`
+	Events              map[string]uint64          `json:"events"`
+	Commands            map[string]uint64          `json:"commands"`
+	CommandErrors       map[string]uint64          `json:"commandErrors"`
+	ParseErrors         map[string]uint64          `json:"parseErrors"`
+	OversizedMessages   uint64                     `json:"oversizedMessages"`
+	Connections         uint64                     `json:"connections"`
+	ActiveConnections   int64                      `json:"activeConnections"`
+	RejectedConnections uint64                     `json:"rejectedConnections"`
+	Actions             map[string]LatencySnapshot `json:"actions"`
+}
+
+type LatencySnapshot struct {
+	Count      uint64  `json:"count"`
+	SumSeconds float64 `json:"sumSeconds"`
+	// Buckets holds cumulative counts for each of LatencyBuckets.
+	Buckets []uint64 `json:"buckets"`
+}
+
+func (r *Registry) Snapshot() Snapshot {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s := Snapshot{
+		UptimeSeconds:       time.Since(r.started).Seconds(),
+		Events:              copyMap(r.events),
+		Commands:            copyMap(r.commands),
+		CommandErrors:       copyMap(r.commandErrors),
+		ParseErrors:         copyMap(r.parseErrors),
+		OversizedMessages:   r.oversized,
+		Connections:         r.connections,
+		ActiveConnections:   r.activeConnections,
+		RejectedConnections: r.rejected,
+		Actions:             map[string]LatencySnapshot{},
+	}
+	for typ, h := range r.actions {
+		ls := LatencySnapshot{Count: h.count, SumSeconds: h.sum, Buckets: make([]uint64, len(LatencyBuckets))}
+		var cum uint64
+		for i := range LatencyBuckets {
+			cum += h.counts[i]
+			ls.Buckets[i] = cum
+		}
+		s.Actions[typ] = ls
+	}
+	return s
+}
+
+func copyMap(m map[string]uint64) map[string]uint64 {
+	c := make(map[string]uint64, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
+
+// WritePrometheus writes s in the Prometheus text exposition format.
+func (s Snapshot) WritePrometheus(w io.Writer) error {
+	ew := &errWriter{w: w}
+
+	ew.printf("# HELP rofi_chrome_tab_uptime_seconds Seconds since the host started.\n")
+	ew.printf("# TYPE rofi_chrome_tab_uptime_seconds gauge\n")
+	ew.printf("rofi_chrome_tab_uptime_seconds %g\n", s.UptimeSeconds)
+
+	counterVec(ew, "rofi_chrome_tab_events_total", "Events received from the extension.", "type", s.Events)
+	counterVec(ew, "rofi_chrome_tab_commands_total", "Socket commands served.", "command", s.Commands)
+	counterVec(ew, "rofi_chrome_tab_command_errors_total", "Socket commands that failed.", "command", s.CommandErrors)
+	counterVec(ew, "rofi_chrome_tab_parse_errors_total", "Messages that could not be parsed.", "source", s.ParseErrors)
+
+	ew.printf("# HELP rofi_chrome_tab_oversized_messages_total Native messages over the size limit.\n")
+	ew.printf("# TYPE rofi_chrome_tab_oversized_messages_total counter\n")
+	ew.printf("rofi_chrome_tab_oversized_messages_total %d\n", s.OversizedMessages)
+	ew.printf("# HELP rofi_chrome_tab_connections_total Socket connections accepted.\n")
+	ew.printf("# TYPE rofi_chrome_tab_connections_total counter\n")
+	ew.printf("rofi_chrome_tab_connections_total %d\n", s.Connections)
+	ew.printf("# HELP rofi_chrome_tab_active_connections Socket connections currently open.\n")
+	ew.printf("# TYPE rofi_chrome_tab_active_connections gauge\n")
+	ew.printf("rofi_chrome_tab_active_connections %d\n", s.ActiveConnections)
+	ew.printf("# HELP rofi_chrome_tab_rejected_connections_total Socket connections refused at the connection limit.\n")
+	ew.printf("# TYPE rofi_chrome_tab_rejected_connections_total counter\n")
+	ew.printf("rofi_chrome_tab_rejected_connections_total %d\n", s.RejectedConnections)
+
+	ew.printf("# HELP rofi_chrome_tab_action_duration_seconds Time taken to send actions to the extension.\n")
+	ew.printf("# TYPE rofi_chrome_tab_action_duration_seconds histogram\n")
+	for _, typ := range sortedKeys(s.Actions) {
+		a := s.Actions[typ]
+		for i, le := range LatencyBuckets {
+			ew.printf("rofi_chrome_tab_action_duration_seconds_bucket{type=%q,le=\"%g\"} %d\n", typ, le, a.Buckets[i])
+		}
+		ew.printf("rofi_chrome_tab_action_duration_seconds_bucket{type=%q,le=\"+Inf\"} %d\n", typ, a.Count)
+		ew.printf("rofi_chrome_tab_action_duration_seconds_sum{type=%q} %g\n", typ, a.SumSeconds)
+		ew.printf("rofi_chrome_tab_action_duration_seconds_count{type=%q} %d\n", typ, a.Count)
+	}
+
+	return ew.err
+}
+
+func counterVec(ew *errWriter, name, help, label string, values map[string]uint64) {
+	ew.printf("# HELP %s %s\n", name, help)
+	ew.printf("# TYPE %s counter\n", name)
+	for _, k := range sortedKeys(values) {
+		ew.printf("%s{%s=%q} %d\n", name, label, k, values[k])
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...any) {
+	if ew.err == nil {
+		_, ew.err = fmt.Fprintf(ew.w, format, args...)
+	}
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	r := New()
+	r.EventReceived("updated")
+	r.EventReceived("updated")
+	r.CommandServed("list", nil)
+	r.CommandServed("select", errors.New("boom"))
+	r.ParseError("command")
+	r.OversizedMessage()
+	r.ConnectionOpened()
+	r.ConnectionOpened()
+	r.ConnectionClosed()
+	r.ConnectionRejected()
+	r.ObserveAction("select", 2*time.Millisecond)
+	r.ObserveAction("select", 2*time.Second)
+
+	s := r.Snapshot()
+	if s.Events["updated"] != 2 {
+		t.Errorf("Events = %v", s.Events)
+	}
+	if s.Commands["select"] != 1 || s.CommandErrors["select"] != 1 || s.CommandErrors["list"] != 0 {
+		t.Errorf("Commands = %v, CommandErrors = %v", s.Commands, s.CommandErrors)
+	}
+	if s.ParseErrors["command"] != 1 || s.OversizedMessages != 1 {
+		t.Errorf("ParseErrors = %v, OversizedMessages = %d", s.ParseErrors, s.OversizedMessages)
+	}
+	if s.Connections != 2 || s.ActiveConnections != 1 || s.RejectedConnections != 1 {
+		t.Errorf("Connections = %d, ActiveConnections = %d, RejectedConnections = %d",
+			s.Connections, s.ActiveConnections, s.RejectedConnections)
+	}
+
+	a := s.Actions["select"]
+	if a.Count != 2 {
+		t.Fatalf("Actions[select].Count = %d", a.Count)
+	}
+	// 2ms falls in the 5ms bucket; 2s is only counted in +Inf
+	want := []uint64{0, 0, 1, 1, 1, 1, 1, 1}
+	for i := range want {
+		if a.Buckets[i] != want[i] {
+			t.Errorf("Buckets = %v, want %v", a.Buckets, want)
+			break
+		}
+	}
+}
+
+func TestWritePrometheus(t *testing.T) {
+	r := New()
+	r.EventReceived("updated")
+	r.ObserveAction("select", time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := r.Snapshot().WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus() error = %v", err)
+	}
+	out := buf.String()
+	for _, line := range []string{
+		"# TYPE rofi_chrome_tab_events_total counter",
+		`rofi_chrome_tab_events_total{type="updated"} 1`,
+		`rofi_chrome_tab_action_duration_seconds_bucket{type="select",le="0.001"} 1`,
+		`rofi_chrome_tab_action_duration_seconds_bucket{type="select",le="+Inf"} 1`,
+		`rofi_chrome_tab_action_duration_seconds_count{type="select"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("output missing %q:\n%s", line, out)
+		}
+	}
+}
+
+func TestServe(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "metrics.sock")
+	r := New()
+	r.EventReceived("updated")
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := Serve(ctx, socketPath, r, slog.Default()); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+		},
+	}}
+	resp, err := client.Get("http://unix/metrics")
+	if err != nil {
+		t.Fatalf("GET /metrics error = %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(body), `rofi_chrome_tab_events_total{type="updated"} 1`) {
+		t.Errorf("unexpected body:\n%s", body)
+	}
+
+	// Once ctx is done the socket goes away
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, err := os.Stat(socketPath); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("socket %s still exists after cancel", socketPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	client.CloseIdleConnections()
+	if _, err := client.Get("http://unix/metrics"); err == nil {
+		t.Error("GET /metrics after cancel succeeded")
+	}
+}
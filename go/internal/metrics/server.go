@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+)
+
+// Serve exposes r in the Prometheus text format at /metrics over HTTP on a
+// unix socket at socketPath until ctx is done, then removes the socket.
+func Serve(ctx context.Context, socketPath string, r *Registry, logger *slog.Logger) error {
+	if err := os.RemoveAll(socketPath); err != nil {
+		return err
+	}
+	lis, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	logger.Info("serving metrics", "path", socketPath)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		if err := r.Snapshot().WritePrometheus(w); err != nil {
+			logger.Warn("write error", "err", err)
+		}
+	})
+
+	srv := &http.Server{Handler: mux}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+		os.Remove(socketPath)
+	}()
+	go func() {
+		if err := srv.Serve(lis); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("metrics server stopped", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,308 @@
+// Package mpris publishes tabs playing sound as MPRIS media players on the
+// D-Bus session bus, so that playerctl and desktop media keys can control
+// them. Each tab gets its own connection and bus name, since a player is the
+// fixed object /org/mpris/MediaPlayer2 of whoever owns the name.
+package mpris
+
+import (
+	"fmt"
+	"log/slog"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/introspect"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+const (
+	// BusPrefix starts the bus name of every player of this host.
+	BusPrefix = "org.mpris.MediaPlayer2.rofi_chrome_tab"
+
+	objectPath  = dbus.ObjectPath("/org/mpris/MediaPlayer2")
+	rootIface   = "org.mpris.MediaPlayer2"
+	playerIface = "org.mpris.MediaPlayer2.Player"
+)
+
+// Player describes a tab playing sound.
+type Player struct {
+	TabID int
+	Title string
+	Host  string
+	URL   string
+	Muted bool
+}
+
+// status is the MPRIS playback status of a tab; a muted tab counts as
+// paused.
+func (p Player) status() string {
+	if p.Muted {
+		return "Paused"
+	}
+	return "Playing"
+}
+
+func (p Player) metadata() map[string]dbus.Variant {
+	return map[string]dbus.Variant{
+		"mpris:trackid": dbus.MakeVariant(dbus.ObjectPath(fmt.Sprintf("/org/rofi_chrome_tab/tab/%d", p.TabID))),
+		"xesam:title":   dbus.MakeVariant(p.Title),
+		"xesam:artist":  dbus.MakeVariant([]string{p.Host}),
+		"xesam:url":     dbus.MakeVariant(p.URL),
+	}
+}
+
+// Controller carries out what media players are asked to do. It is called
+// from D-Bus goroutines.
+type Controller interface {
+	// Mute mutes or unmutes a tab.
+	Mute(tabID int, muted bool) error
+	// Raise switches to a tab.
+	Raise(tabID int) error
+}
+
+// Bridge keeps one media player per tab playing sound.
+type Bridge struct {
+	connect  func() (*dbus.Conn, error)
+	ctl      Controller
+	identity string
+	pid      int
+	logger   *slog.Logger
+	updates  chan []Player
+	// players is only used by Run.
+	players map[int]*player
+}
+
+// New returns a bridge that connects to the bus with connect, usually
+// dbus.ConnectSessionBus. identity names the players, e.g. "Chromium". pid
+// tells players of several hosts apart.
+func New(connect func() (*dbus.Conn, error), ctl Controller, identity string, pid int, logger *slog.Logger) *Bridge {
+	return &Bridge{
+		connect:  connect,
+		ctl:      ctl,
+		identity: identity,
+		pid:      pid,
+		logger:   logger,
+		updates:  make(chan []Player, 1),
+		players:  map[int]*player{},
+	}
+}
+
+// BusName returns the bus name of a tab's player.
+func (b *Bridge) BusName(tabID int) string {
+	return fmt.Sprintf("%s.instance%d_tab%d", BusPrefix, b.pid, tabID)
+}
+
+// Update sets the tabs that should have players. It does not block; Run
+// applies the latest update.
+func (b *Bridge) Update(players []Player) {
+	for {
+		select {
+		case b.updates <- players:
+			return
+		case <-b.updates:
+			// Replace the update not applied yet
+		}
+	}
+}
+
+// Run applies updates until done is closed, then removes every player.
+func (b *Bridge) Run(done <-chan struct{}) {
+	defer func() {
+		for id, p := range b.players {
+			p.close()
+			delete(b.players, id)
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		case players := <-b.updates:
+			b.apply(players)
+		}
+	}
+}
+
+func (b *Bridge) apply(players []Player) {
+	want := map[int]Player{}
+	for _, p := range players {
+		want[p.TabID] = p
+	}
+	for id, p := range b.players {
+		if _, ok := want[id]; !ok {
+			p.close()
+			delete(b.players, id)
+		}
+	}
+	for id, tab := range want {
+		if p, ok := b.players[id]; ok {
+			p.update(tab)
+			continue
+		}
+		p, err := b.open(tab)
+		if err != nil {
+			b.logger.Warn("cannot publish media player", "tab", id, "err", err)
+			continue
+		}
+		b.players[id] = p
+	}
+}
+
+// player is the media player of one tab.
+type player struct {
+	conn  *dbus.Conn
+	props *prop.Properties
+	tab   Player
+}
+
+func (b *Bridge) open(tab Player) (*player, error) {
+	conn, err := b.connect()
+	if err != nil {
+		return nil, err
+	}
+	p := &player{conn: conn, tab: tab}
+	if err := b.export(p); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Claim the name last, once the player is complete
+	reply, err := conn.RequestName(b.BusName(tab.TabID), dbus.NameFlagDoNotQueue)
+	if err == nil && reply != dbus.RequestNameReplyPrimaryOwner {
+		err = fmt.Errorf("bus name %s is taken", b.BusName(tab.TabID))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+func (b *Bridge) export(p *player) error {
+	root := rootMethods{ctl: b.ctl, tabID: p.tab.TabID}
+	control := playerMethods{ctl: b.ctl, tabID: p.tab.TabID, p: p}
+	props, err := prop.Export(p.conn, objectPath, prop.Map{
+		rootIface: {
+			"CanQuit":             {Value: false, Emit: prop.EmitConst},
+			"CanRaise":            {Value: true, Emit: prop.EmitConst},
+			"HasTrackList":        {Value: false, Emit: prop.EmitConst},
+			"Identity":            {Value: b.identity, Emit: prop.EmitConst},
+			"SupportedUriSchemes": {Value: []string{}, Emit: prop.EmitConst},
+			"SupportedMimeTypes":  {Value: []string{}, Emit: prop.EmitConst},
+		},
+		playerIface: {
+			"PlaybackStatus": {Value: p.tab.status(), Emit: prop.EmitTrue},
+			"Metadata":       {Value: p.tab.metadata(), Emit: prop.EmitTrue},
+			"Rate":           {Value: 1.0, Emit: prop.EmitConst},
+			"MinimumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"MaximumRate":    {Value: 1.0, Emit: prop.EmitConst},
+			"Volume":         {Value: 1.0, Emit: prop.EmitConst},
+			"Position":       {Value: int64(0), Emit: prop.EmitFalse},
+			"CanGoNext":      {Value: false, Emit: prop.EmitConst},
+			"CanGoPrevious":  {Value: false, Emit: prop.EmitConst},
+			"CanPlay":        {Value: true, Emit: prop.EmitConst},
+			"CanPause":       {Value: true, Emit: prop.EmitConst},
+			"CanSeek":        {Value: false, Emit: prop.EmitConst},
+			"CanControl":     {Value: true, Emit: prop.EmitConst},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	p.props = props
+
+	if err := p.conn.Export(root, objectPath, rootIface); err != nil {
+		return err
+	}
+	if err := p.conn.ExportWithMap(control, dbusNames, objectPath, playerIface); err != nil {
+		return err
+	}
+	controlMethods := introspect.Methods(control)
+	for i, m := range controlMethods {
+		if name, ok := dbusNames[m.Name]; ok {
+			controlMethods[i].Name = name
+		}
+	}
+	node := &introspect.Node{
+		Name: string(objectPath),
+		Interfaces: []introspect.Interface{
+			introspect.IntrospectData,
+			prop.IntrospectData,
+			{Name: rootIface, Methods: introspect.Methods(root), Properties: props.Introspection(rootIface)},
+			{Name: playerIface, Methods: controlMethods, Properties: props.Introspection(playerIface)},
+		},
+	}
+	return p.conn.Export(introspect.NewIntrospectable(node), objectPath, "org.freedesktop.DBus.Introspectable")
+}
+
+// update publishes changes to the tab, which emits PropertiesChanged.
+func (p *player) update(tab Player) {
+	if tab.Title != p.tab.Title || tab.Host != p.tab.Host || tab.URL != p.tab.URL {
+		p.props.SetMust(playerIface, "Metadata", tab.metadata())
+	}
+	p.setStatus(tab.status())
+	p.tab = tab
+}
+
+func (p *player) setStatus(status string) {
+	if p.props.GetMust(playerIface, "PlaybackStatus") != status {
+		p.props.SetMust(playerIface, "PlaybackStatus", status)
+	}
+}
+
+// close releases the bus name, which removes the player.
+func (p *player) close() {
+	p.conn.Close()
+}
+
+// rootMethods implement org.mpris.MediaPlayer2.
+type rootMethods struct {
+	ctl   Controller
+	tabID int
+}
+
+func (r rootMethods) Raise() *dbus.Error {
+	if err := r.ctl.Raise(r.tabID); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	return nil
+}
+
+// Quit does nothing; CanQuit is false.
+func (r rootMethods) Quit() *dbus.Error {
+	return nil
+}
+
+// dbusNames maps methods whose D-Bus name would clash with a Go convention.
+var dbusNames = map[string]string{"SeekBy": "Seek"}
+
+// playerMethods implement org.mpris.MediaPlayer2.Player by muting and
+// unmuting the tab. Track and position controls do nothing, as allowed by
+// the Can* properties.
+type playerMethods struct {
+	ctl   Controller
+	tabID int
+	p     *player
+}
+
+func (m playerMethods) mute(muted bool) *dbus.Error {
+	if err := m.ctl.Mute(m.tabID, muted); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+	// Report the new status right away rather than when the tab update
+	// comes back
+	m.p.setStatus(Player{Muted: muted}.status())
+	return nil
+}
+
+func (m playerMethods) PlayPause() *dbus.Error {
+	return m.mute(m.p.props.GetMust(playerIface, "PlaybackStatus") == "Playing")
+}
+
+func (m playerMethods) Play() *dbus.Error  { return m.mute(false) }
+func (m playerMethods) Pause() *dbus.Error { return m.mute(true) }
+func (m playerMethods) Stop() *dbus.Error  { return m.mute(true) }
+
+func (m playerMethods) Next() *dbus.Error                              { return nil }
+func (m playerMethods) Previous() *dbus.Error                          { return nil }
+func (m playerMethods) SeekBy(int64) *dbus.Error                       { return nil }
+func (m playerMethods) SetPosition(dbus.ObjectPath, int64) *dbus.Error { return nil }
+func (m playerMethods) OpenUri(string) *dbus.Error                     { return nil }
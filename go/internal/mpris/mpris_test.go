@@ -0,0 +1,139 @@
+package mpris
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+
+	"rofi-chrome-tab/internal/testharness"
+)
+
+type fakeController struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (c *fakeController) Mute(tabID int, muted bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, fmt.Sprintf("mute %d %t", tabID, muted))
+	return nil
+}
+
+func (c *fakeController) Raise(tabID int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls = append(c.calls, fmt.Sprintf("raise %d", tabID))
+	return nil
+}
+
+func (c *fakeController) Calls() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return slices.Clone(c.calls)
+}
+
+// eventually polls cond until it holds or a few seconds passed.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func names(t *testing.T, conn *dbus.Conn) []string {
+	t.Helper()
+	var names []string
+	if err := conn.BusObject().Call("org.freedesktop.DBus.ListNames", 0).Store(&names); err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestBridge(t *testing.T) {
+	addr := testharness.StartBus(t)
+	client, err := dbus.Connect(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctl := &fakeController{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	b := New(func() (*dbus.Conn, error) { return dbus.Connect(addr) }, ctl, "Chromium", 42, logger)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		b.Run(done)
+	}()
+
+	b.Update([]Player{{TabID: 7, Title: "Song", Host: "music.test", URL: "https://music.test/7"}})
+	name := b.BusName(7)
+	if name != "org.mpris.MediaPlayer2.rofi_chrome_tab.instance42_tab7" {
+		t.Errorf("BusName() = %q", name)
+	}
+	eventually(t, "player on the bus", func() bool { return slices.Contains(names(t, client), name) })
+
+	obj := client.Object(name, objectPath)
+	get := func(iface, prop string) dbus.Variant {
+		t.Helper()
+		v, err := obj.GetProperty(iface + "." + prop)
+		if err != nil {
+			t.Fatalf("get %s: %v", prop, err)
+		}
+		return v
+	}
+	if id := get(rootIface, "Identity").Value(); id != "Chromium" {
+		t.Errorf("Identity = %v", id)
+	}
+	if status := get(playerIface, "PlaybackStatus").Value(); status != "Playing" {
+		t.Errorf("PlaybackStatus = %v", status)
+	}
+	meta := get(playerIface, "Metadata").Value().(map[string]dbus.Variant)
+	if meta["xesam:title"].Value() != "Song" || fmt.Sprint(meta["xesam:artist"].Value()) != "[music.test]" {
+		t.Errorf("Metadata = %v", meta)
+	}
+
+	// What playerctl play-pause and raise do
+	if err := obj.Call(playerIface+".PlayPause", 0).Err; err != nil {
+		t.Fatalf("PlayPause: %v", err)
+	}
+	if status := get(playerIface, "PlaybackStatus").Value(); status != "Paused" {
+		t.Errorf("PlaybackStatus after PlayPause = %v", status)
+	}
+	if err := obj.Call(rootIface+".Raise", 0).Err; err != nil {
+		t.Fatalf("Raise: %v", err)
+	}
+	if err := obj.Call(playerIface+".Seek", 0, int64(1000)).Err; err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	if calls := ctl.Calls(); fmt.Sprint(calls) != "[mute 7 true raise 7]" {
+		t.Errorf("controller calls = %v", calls)
+	}
+
+	// Tab updates change the player; tabs going quiet remove it
+	b.Update([]Player{{TabID: 7, Title: "Next song", Host: "music.test", Muted: true}, {TabID: 8, Title: "Video"}})
+	eventually(t, "second player", func() bool { return slices.Contains(names(t, client), b.BusName(8)) })
+	meta = get(playerIface, "Metadata").Value().(map[string]dbus.Variant)
+	if meta["xesam:title"].Value() != "Next song" {
+		t.Errorf("Metadata after update = %v", meta)
+	}
+
+	b.Update([]Player{{TabID: 8, Title: "Video"}})
+	eventually(t, "first player gone", func() bool { return !slices.Contains(names(t, client), name) })
+
+	close(done)
+	<-stopped
+	eventually(t, "players gone", func() bool { return !slices.Contains(names(t, client), b.BusName(8)) })
+}
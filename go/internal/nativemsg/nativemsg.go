@@ -0,0 +1,131 @@
+// Package nativemsg implements Chrome's native messaging framing: each
+// message is a JSON document preceded by its length as a 32-bit unsigned
+// integer in native (little-endian on every platform we support) byte order.
+package nativemsg
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// MaxOutgoing is the largest message Chrome accepts from a native host.
+	// Larger messages make Chrome close the port.
+	MaxOutgoing = 1024 * 1024
+	// DefaultMaxIncoming bounds what a Reader allocates for one message
+	// unless told otherwise.
+	DefaultMaxIncoming = 10 * 1024 * 1024
+)
+
+// SizeError reports a message over the size limit.
+type SizeError struct {
+	Size int
+	Max  int
+}
+
+func (e *SizeError) Error() string {
+	return fmt.Sprintf("native message of %d bytes exceeds limit of %d bytes", e.Size, e.Max)
+}
+
+// IsTooLarge reports whether err is, or wraps, a *SizeError.
+func IsTooLarge(err error) bool {
+	var se *SizeError
+	return errors.As(err, &se)
+}
+
+// Writer frames messages onto an underlying writer. It is safe for concurrent
+// use; each message is written whole.
+type Writer struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// WriteMessage writes data as one message. Messages over MaxOutgoing are
+// refused with a *SizeError and nothing is written.
+func (w *Writer) WriteMessage(data []byte) error {
+	if len(data) > MaxOutgoing {
+		return &SizeError{Size: len(data), Max: MaxOutgoing}
+	}
+
+	buf := make([]byte, 4, 4+len(data))
+	binary.LittleEndian.PutUint32(buf, uint32(len(data)))
+	buf = append(buf, data...)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// Encode writes the JSON encoding of v as one message.
+func (w *Writer) Encode(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return w.WriteMessage(data)
+}
+
+// Reader reads framed messages. It is not safe for concurrent use.
+type Reader struct {
+	r   io.Reader
+	max int
+}
+
+// NewReader returns a Reader refusing messages over max bytes; max <= 0
+// means DefaultMaxIncoming.
+func NewReader(r io.Reader, max int) *Reader {
+	if max <= 0 {
+		max = DefaultMaxIncoming
+	}
+	return &Reader{r: r, max: max}
+}
+
+// ReadMessage returns the next message. It returns io.EOF at a clean end of
+// input, io.ErrUnexpectedEOF when input ends inside a message, and a
+// *SizeError for a message over the limit. An oversized message is skipped
+// without being buffered, so reading can go on with the next one.
+func (r *Reader) ReadMessage() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r.r, header[:]); err != nil {
+		return nil, err
+	}
+
+	length := binary.LittleEndian.Uint32(header[:])
+	if uint64(length) > uint64(r.max) {
+		n, err := io.CopyN(io.Discard, r.r, int64(length))
+		if err == io.EOF && n < int64(length) {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		return nil, &SizeError{Size: int(length), Max: r.max}
+	}
+
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf, nil
+}
+
+// Decode reads the next message into v.
+func (r *Reader) Decode(v any) error {
+	data, err := r.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,145 @@
+package nativemsg
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, msg := range []string{`{"a":1}`, `{}`, `"日本語"`} {
+		if err := w.WriteMessage([]byte(msg)); err != nil {
+			t.Fatalf("WriteMessage(%s) error = %v", msg, err)
+		}
+	}
+
+	r := NewReader(&buf, 0)
+	for _, want := range []string{`{"a":1}`, `{}`, `"日本語"`} {
+		got, err := r.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage() error = %v", err)
+		}
+		if string(got) != want {
+			t.Errorf("ReadMessage() = %s, want %s", got, want)
+		}
+	}
+	if _, err := r.ReadMessage(); err != io.EOF {
+		t.Errorf("ReadMessage() at end error = %v, want io.EOF", err)
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf).Encode(map[string]int{"tabId": 42}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if got, want := buf.Bytes()[:4], []byte{12, 0, 0, 0}; !bytes.Equal(got, want) {
+		t.Errorf("length prefix = %v, want %v", got, want)
+	}
+
+	var v struct {
+		TabID int `json:"tabId"`
+	}
+	if err := NewReader(&buf, 0).Decode(&v); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if v.TabID != 42 {
+		t.Errorf("Decode() tabId = %d, want 42", v.TabID)
+	}
+}
+
+func TestWriterRefusesOversized(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	if err := w.WriteMessage(make([]byte, MaxOutgoing)); err != nil {
+		t.Fatalf("WriteMessage(MaxOutgoing) error = %v", err)
+	}
+	buf.Reset()
+
+	err := w.WriteMessage(make([]byte, MaxOutgoing+1))
+	if !IsTooLarge(err) {
+		t.Fatalf("WriteMessage(MaxOutgoing+1) error = %v, want SizeError", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("oversized message wrote %d bytes", buf.Len())
+	}
+}
+
+func TestReaderLimitAndTruncation(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []byte
+		check func(error) bool
+	}{
+		{"over limit", []byte{9, 0, 0, 0, '"', 'x', 'x', 'x', 'x', 'x', 'x', 'x', '"'}, IsTooLarge},
+		{"over limit truncated", []byte{0xff, 0xff, 0xff, 0xff, '"'}, func(err error) bool { return err == io.ErrUnexpectedEOF }},
+		{"partial header", []byte{1, 0}, func(err error) bool { return err == io.ErrUnexpectedEOF }},
+		{"partial body", []byte{4, 0, 0, 0, '{'}, func(err error) bool { return err == io.ErrUnexpectedEOF }},
+		{"missing body", []byte{4, 0, 0, 0}, func(err error) bool { return err == io.ErrUnexpectedEOF }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewReader(bytes.NewReader(tt.input), 8).ReadMessage()
+			if !tt.check(err) {
+				t.Errorf("ReadMessage() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestReaderSkipsOversized(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	for _, msg := range []string{`"small"`, `"much too large"`, `"next"`} {
+		if err := w.WriteMessage([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r := NewReader(&buf, 8)
+	if got, err := r.ReadMessage(); err != nil || string(got) != `"small"` {
+		t.Fatalf("first ReadMessage() = %s, %v", got, err)
+	}
+	_, err := r.ReadMessage()
+	var se *SizeError
+	if !errors.As(err, &se) || se.Size != 16 || se.Max != 8 {
+		t.Fatalf("second ReadMessage() error = %v, want SizeError{16, 8}", err)
+	}
+	if got, err := r.ReadMessage(); err != nil || string(got) != `"next"` {
+		t.Errorf("ReadMessage() after oversized = %s, %v", got, err)
+	}
+}
+
+func TestWriterConcurrent(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+	msg := `"` + strings.Repeat("x", 4096) + `"`
+
+	var wg sync.WaitGroup
+	for range 16 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				if err := w.WriteMessage([]byte(msg)); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	r := NewReader(&buf, 0)
+	for i := range 160 {
+		got, err := r.ReadMessage()
+		if err != nil || string(got) != msg {
+			t.Fatalf("message %d: interleaved or corrupt (err %v)", i, err)
+		}
+	}
+}
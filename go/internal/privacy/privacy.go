@@ -0,0 +1,79 @@
+package privacy
+
+import (
+	"log/slog"
+	"path"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// Placeholder replaces redacted titles, hosts and URLs.
+const Placeholder = "[redacted]"
+
+// Policy decides what may be shown, logged and stored. Tabs on redacted hosts
+// are always redacted and incognito tabs are never stored, as the browser
+// does not store them either; privacy mode additionally keeps incognito tabs
+// out of logs.
+type Policy struct {
+	enabled       bool
+	redactedHosts []string
+}
+
+func New(cfg config.PrivacyConfig) Policy {
+	return Policy{enabled: cfg.Enabled, redactedHosts: cfg.RedactedHosts}
+}
+
+// IsRedacted reports whether tab is on a redacted host.
+func (p Policy) IsRedacted(tab protocol.Tab) bool {
+	for _, pattern := range p.redactedHosts {
+		if ok, _ := path.Match(pattern, tab.Host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact returns tab with identifying fields replaced when it is on a
+// redacted host.
+func (p Policy) Redact(tab protocol.Tab) protocol.Tab {
+	if !p.IsRedacted(tab) {
+		return tab
+	}
+	tab.Title = Placeholder
+	tab.Host = Placeholder
+	if tab.URL != "" {
+		tab.URL = Placeholder
+	}
+	return tab
+}
+
+// Persistable reports whether tab may be written to disk or recorded in any
+// history: it is neither incognito nor on a redacted host.
+func (p Policy) Persistable(tab protocol.Tab) bool {
+	return !tab.Incognito && !p.IsRedacted(tab)
+}
+
+// LogTab returns a log attribute describing tab without leaking private
+// details.
+func (p Policy) LogTab(key string, tab protocol.Tab) slog.Attr {
+	if (p.enabled && tab.Incognito) || p.IsRedacted(tab) {
+		return slog.Group(key, "id", tab.ID, "title", Placeholder)
+	}
+	return slog.Group(key, "id", tab.ID, "title", tab.Title, "host", tab.Host)
+}
+
+// FilterIncognito selects tabs by incognito mode: "include" keeps all tabs,
+// "exclude" drops incognito ones and "only" keeps only incognito ones.
+func FilterIncognito(tabs []protocol.Tab, mode string) []protocol.Tab {
+	if mode == "include" || mode == "" {
+		return tabs
+	}
+	filtered := make([]protocol.Tab, 0, len(tabs))
+	for _, tab := range tabs {
+		if tab.Incognito == (mode == "only") {
+			filtered = append(filtered, tab)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,89 @@
+package privacy
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"rofi-chrome-tab/internal/config"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+var (
+	normal    = protocol.Tab{ID: 1, Title: "News", Host: "news.example.com"}
+	incognito = protocol.Tab{ID: 2, Title: "Gift ideas", Host: "shop.example.com", Incognito: true}
+	bank      = protocol.Tab{ID: 3, Title: "Balance", Host: "online.bank.test", URL: "https://online.bank.test/accounts"}
+)
+
+func TestRedact(t *testing.T) {
+	p := New(config.PrivacyConfig{RedactedHosts: []string{"*.bank.test"}})
+
+	if got := p.Redact(normal); got != normal {
+		t.Errorf("Redact(normal) = %+v", got)
+	}
+	got := p.Redact(bank)
+	if got.Title != Placeholder || got.Host != Placeholder || got.URL != Placeholder || got.ID != bank.ID {
+		t.Errorf("Redact(bank) = %+v", got)
+	}
+}
+
+func TestPersistable(t *testing.T) {
+	off := New(config.PrivacyConfig{RedactedHosts: []string{"*.bank.test"}})
+	on := New(config.PrivacyConfig{Enabled: true, RedactedHosts: []string{"*.bank.test"}})
+
+	tests := []struct {
+		name   string
+		policy Policy
+		tab    protocol.Tab
+		want   bool
+	}{
+		{"normal", on, normal, true},
+		{"incognito with privacy mode", on, incognito, false},
+		{"incognito without privacy mode", off, incognito, false},
+		{"redacted host", off, bank, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.Persistable(tt.tab); got != tt.want {
+			t.Errorf("%s: Persistable() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestLogTab(t *testing.T) {
+	p := New(config.PrivacyConfig{Enabled: true, RedactedHosts: []string{"*.bank.test"}})
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	logger.Info("tabs", p.LogTab("a", normal), p.LogTab("b", incognito), p.LogTab("c", bank))
+
+	out := buf.String()
+	if !strings.Contains(out, "news.example.com") {
+		t.Errorf("normal tab missing from log: %s", out)
+	}
+	for _, secret := range []string{"Gift ideas", "shop.example.com", "Balance", "bank.test"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log leaks %q: %s", secret, out)
+		}
+	}
+}
+
+func TestFilterIncognito(t *testing.T) {
+	tabs := []protocol.Tab{normal, incognito}
+	for mode, want := range map[string][]int{
+		"include": {1, 2},
+		"exclude": {1},
+		"only":    {2},
+	} {
+		got := FilterIncognito(tabs, mode)
+		if len(got) != len(want) {
+			t.Errorf("FilterIncognito(%s) = %+v", mode, got)
+			continue
+		}
+		for i := range want {
+			if got[i].ID != want[i] {
+				t.Errorf("FilterIncognito(%s) = %+v", mode, got)
+			}
+		}
+	}
+}
@@ -1,9 +1,10 @@
 package protocol
 
 import (
-	"encoding/binary"
 	"encoding/json"
-	"io"
+	"fmt"
+
+	"rofi-chrome-tab/internal/nativemsg"
 )
 
 type Action interface {
@@ -18,35 +19,159 @@ func (a SelectAction) Type() string {
 	return "select"
 }
 
-func SendAction(w io.Writer, a Action) error {
+// HelloAction answers the extension's HelloEvent.
+type HelloAction struct {
+	ProtocolVersion int    `json:"protocolVersion"`
+	HostVersion     string `json:"hostVersion"`
+	// Accepted is false when the extension's protocol is too old; the host
+	// then sends no further actions.
+	Accepted bool `json:"accepted"`
+	// Thumbnails asks the extension to send a ThumbnailEvent for each tab
+	// it shows.
+	Thumbnails bool `json:"thumbnails,omitempty"`
+}
+
+func (a HelloAction) Type() string {
+	return "hello"
+}
+
+// ResyncAction asks the extension to send its tabs again after the host
+// dropped a message.
+type ResyncAction struct {
+	Reason string `json:"reason"`
+	// MaxMessageSize is the largest message the host accepts, so the
+	// extension can shrink the next update.
+	MaxMessageSize int `json:"maxMessageSize"`
+}
+
+func (a ResyncAction) Type() string {
+	return "resync"
+}
+
+// ReopenAction asks the extension to bring back a closed tab, from the
+// browser's own session history if it still has it, or else by opening URL
+// where the tab used to be.
+type ReopenAction struct {
+	URL      string `json:"url"`
+	WindowID int    `json:"windowId,omitempty"`
+	Index    int    `json:"index"`
+	GroupID  int    `json:"groupId,omitempty"`
+	Pinned   bool   `json:"pinned,omitempty"`
+	// Incognito marks a private tab, which may only be opened again in its
+	// incognito window.
+	Incognito bool `json:"incognito,omitempty"`
+}
+
+func (a ReopenAction) Type() string {
+	return "reopen"
+}
+
+// OpenAction asks the extension to open tabs, either in the current window
+// or in a new one, and to put them in the listed groups.
+type OpenAction struct {
+	Tabs []OpenTab `json:"tabs"`
+	// Groups describe the groups named by the tabs' GroupID.
+	Groups    []Group `json:"groups,omitempty"`
+	NewWindow bool    `json:"newWindow,omitempty"`
+}
+
+// OpenTab is a tab to open. GroupID refers to OpenAction.Groups, not to a
+// live group.
+type OpenTab struct {
+	URL     string `json:"url"`
+	Pinned  bool   `json:"pinned,omitempty"`
+	GroupID int    `json:"groupId,omitempty"`
+}
+
+func (a OpenAction) Type() string {
+	return "open"
+}
+
+// BookmarkAction asks the extension to bookmark a tab in Folder, a path of
+// folder titles like BookmarksEvent's, created if missing. An empty Folder
+// means the browser's default folder.
+type BookmarkAction struct {
+	TabID  int    `json:"tabId"`
+	Folder string `json:"folder,omitempty"`
+}
+
+func (a BookmarkAction) Type() string {
+	return "bookmark"
+}
+
+// HistoryAction asks the extension to search the browser history. It is
+// answered by a ResponseEvent with the same RequestID whose result is a list
+// of HistoryItem.
+type HistoryAction struct {
+	RequestID int    `json:"requestId"`
+	Query     string `json:"query"`
+	// StartTime limits results to pages visited since then, in milliseconds
+	// since the epoch.
+	StartTime  float64 `json:"startTime"`
+	MaxResults int     `json:"maxResults"`
+}
+
+func (a HistoryAction) Type() string {
+	return "history"
+}
+
+// ScreenshotAction asks the extension to switch to a tab and capture it as a
+// PNG. The image is sent base64 encoded in ChunkEvents, each under the size
+// limit of native messages, followed by a ResponseEvent whose result is a
+// ScreenshotResult.
+type ScreenshotAction struct {
+	RequestID int `json:"requestId"`
+	TabID     int `json:"tabId"`
+}
+
+func (a ScreenshotAction) Type() string {
+	return "screenshot"
+}
+
+// ScreenshotResult is the result of a ScreenshotAction.
+type ScreenshotResult struct {
+	// Chunks is the number of ChunkEvents sent, so the host can tell that
+	// none went missing.
+	Chunks int `json:"chunks"`
+}
+
+// MuteAction asks the extension to mute or unmute tabs.
+type MuteAction struct {
+	TabIDs []int `json:"tabIds"`
+	Muted  bool  `json:"muted"`
+}
+
+func (a MuteAction) Type() string {
+	return "mute"
+}
+
+// MarshalAction encodes a as the extension expects it: the action's fields
+// plus a "command" key naming it.
+func MarshalAction(a Action) ([]byte, error) {
 	payload, err := json.Marshal(a)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	var body map[string]interface{}
-	if err := json.Unmarshal(payload, &body); err != nil {
-		return err
+	if len(payload) < 2 || payload[0] != '{' {
+		return nil, fmt.Errorf("action %s does not encode as an object", a.Type())
 	}
 
-	body["command"] = a.Type()
-
-	data, err := json.Marshal(body)
+	command, err := json.Marshal(a.Type())
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	length := uint32(len(data))
-	var lenBuf [4]byte
-	binary.LittleEndian.PutUint32(lenBuf[:], length)
-
-	if _, err := w.Write(lenBuf[:]); err != nil {
-		return err
+	data := append([]byte(`{"command":`), command...)
+	if len(payload) > 2 {
+		data = append(data, ',')
 	}
+	return append(data, payload[1:]...), nil
+}
 
-	if _, err := w.Write(data); err != nil {
+// SendAction writes a to the extension as one native message.
+func SendAction(w *nativemsg.Writer, a Action) error {
+	data, err := MarshalAction(a)
+	if err != nil {
 		return err
 	}
-
-	return nil
+	return w.WriteMessage(data)
 }
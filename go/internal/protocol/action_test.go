@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"encoding/json"
 	"testing"
+
+	"rofi-chrome-tab/internal/nativemsg"
 )
 
 func TestSendAction(t *testing.T) {
@@ -12,7 +14,7 @@ func TestSendAction(t *testing.T) {
 
 	cmd := &SelectAction{TabID: 42}
 
-	err := SendAction(&buf, cmd)
+	err := SendAction(nativemsg.NewWriter(&buf), cmd)
 	if err != nil {
 		t.Fatalf("SendAction failed: %v", err)
 	}
@@ -39,3 +41,28 @@ func TestSendAction(t *testing.T) {
 		t.Errorf("unexpected tabId: got %v, want %v", result["tabId"], 42)
 	}
 }
+
+type emptyAction struct{}
+
+func (emptyAction) Type() string { return "empty" }
+
+func TestMarshalAction(t *testing.T) {
+	tests := []struct {
+		action Action
+		want   string
+	}{
+		{SelectAction{TabID: 42}, `{"command":"select","tabId":42}`},
+		{HelloAction{ProtocolVersion: 1, HostVersion: "v1", Accepted: true},
+			`{"command":"hello","protocolVersion":1,"hostVersion":"v1","accepted":true}`},
+		{emptyAction{}, `{"command":"empty"}`},
+	}
+	for _, tt := range tests {
+		got, err := MarshalAction(tt.action)
+		if err != nil {
+			t.Fatalf("MarshalAction(%#v) error = %v", tt.action, err)
+		}
+		if string(got) != tt.want {
+			t.Errorf("MarshalAction(%#v) = %s, want %s", tt.action, got, tt.want)
+		}
+	}
+}
@@ -2,45 +2,570 @@ package protocol
 
 import (
 	"fmt"
+	"math"
+	"net/url"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Command interface {
 	isCommand()
+	Name() string
 }
 
-type ListCommand struct{}
+type ListCommand struct {
+	// Template overrides the configured row template when not empty.
+	Template string
+	// Browser and Profile, when set, list nothing unless this host serves a
+	// matching browser product and profile.
+	Browser string
+	Profile string
+	// Incognito overrides the configured incognito mode: include, exclude or
+	// only.
+	Incognito string
+}
 
-func (ListCommand) isCommand() {}
+func (ListCommand) isCommand()   {}
+func (ListCommand) Name() string { return "list" }
 
 type SelectCommand struct {
 	TabID int
 }
 
-func (SelectCommand) isCommand() {}
+func (SelectCommand) isCommand()   {}
+func (SelectCommand) Name() string { return "select" }
+
+// StatsCommand reports the host's metrics as JSON.
+type StatsCommand struct{}
+
+func (StatsCommand) isCommand()   {}
+func (StatsCommand) Name() string { return "stats" }
+
+// VersionCommand reports the versions of the host and the extension.
+type VersionCommand struct{}
+
+func (VersionCommand) isCommand()   {}
+func (VersionCommand) Name() string { return "version" }
+
+// PingCommand checks that the host is alive.
+type PingCommand struct{}
+
+func (PingCommand) isCommand()   {}
+func (PingCommand) Name() string { return "ping" }
+
+// LogLevelCommand changes the log level, or reports it when Level is empty.
+type LogLevelCommand struct {
+	Level string
+}
+
+func (LogLevelCommand) isCommand()   {}
+func (LogLevelCommand) Name() string { return "loglevel" }
+
+// ClosedCommand lists recently closed tabs, most recent first.
+type ClosedCommand struct{}
+
+func (ClosedCommand) isCommand()   {}
+func (ClosedCommand) Name() string { return "closed" }
+
+// ReopenCommand reopens the Nth most recently closed tab, counting from 1.
+type ReopenCommand struct {
+	N int
+}
+
+func (ReopenCommand) isCommand()   {}
+func (ReopenCommand) Name() string { return "reopen" }
+
+// UndoCommand reopens the most recently closed tab.
+type UndoCommand struct{}
+
+func (UndoCommand) isCommand()   {}
+func (UndoCommand) Name() string { return "undo" }
+
+// SessionCommand manages named sessions: save, list, restore or delete.
+type SessionCommand struct {
+	Action  string
+	Session string
+	// WindowID limits save to one window; 0 saves all windows.
+	WindowID int
+	// NewWindow restores each saved window into a new browser window.
+	NewWindow bool
+}
+
+func (SessionCommand) isCommand()   {}
+func (SessionCommand) Name() string { return "session" }
+
+// SnapshotsCommand lists the automatic snapshots, oldest first.
+type SnapshotsCommand struct{}
+
+func (SnapshotsCommand) isCommand()   {}
+func (SnapshotsCommand) Name() string { return "snapshots" }
+
+// SnapshotRestoreCommand restores the snapshot taken at Timestamp, as listed
+// by SnapshotsCommand.
+type SnapshotRestoreCommand struct {
+	Timestamp string
+	NewWindow bool
+}
+
+func (SnapshotRestoreCommand) isCommand()   {}
+func (SnapshotRestoreCommand) Name() string { return "snapshot" }
+
+// ExportCommand writes the open tabs as a link list in Format: markdown,
+// html, csv, onetab or urls.
+type ExportCommand struct {
+	Format string
+	// WindowID limits the export to one window; 0 exports all windows.
+	WindowID int
+	// Group limits the export to a tab group, by title or ID.
+	Group string
+}
+
+func (ExportCommand) isCommand()   {}
+func (ExportCommand) Name() string { return "export" }
+
+// BookmarksCommand lists the bookmarks with their folders.
+type BookmarksCommand struct{}
+
+func (BookmarksCommand) isCommand()   {}
+func (BookmarksCommand) Name() string { return "bookmarks" }
+
+// OpenBookmarkCommand switches to a tab showing the bookmark, or opens it.
+type OpenBookmarkCommand struct {
+	ID string
+}
+
+func (OpenBookmarkCommand) isCommand()   {}
+func (OpenBookmarkCommand) Name() string { return "open-bookmark" }
+
+// BookmarkCommand bookmarks a tab, in Folder if set.
+type BookmarkCommand struct {
+	TabID  int
+	Folder string
+}
+
+func (BookmarkCommand) isCommand()   {}
+func (BookmarkCommand) Name() string { return "bookmark" }
+
+// HistoryCommand searches the browser history.
+type HistoryCommand struct {
+	Query string
+	// Since limits results to pages visited this long ago or later; 0
+	// searches all history.
+	Since time.Duration
+	Limit int
+}
+
+func (HistoryCommand) isCommand()   {}
+func (HistoryCommand) Name() string { return "history" }
+
+// MaxHistoryResults bounds HistoryCommand.Limit.
+const MaxHistoryResults = 1000
+
+// OpenURLCommand switches to a tab showing URL, or opens it.
+type OpenURLCommand struct {
+	URL string
+}
+
+func (OpenURLCommand) isCommand()   {}
+func (OpenURLCommand) Name() string { return "open" }
+
+// LaunchCommand lists open tabs, closed tabs, bookmarks and history pages
+// matching Query, best first.
+type LaunchCommand struct {
+	Query string
+	Limit int
+}
+
+func (LaunchCommand) isCommand()   {}
+func (LaunchCommand) Name() string { return "launch" }
+
+// MediaCommand controls tabs playing sound: list, focus, mute-others or
+// toggle.
+type MediaCommand struct {
+	Action string
+	// TabID is the tab to toggle, or to keep playing for mute-others; 0
+	// there means the most recently used audible tab.
+	TabID int
+}
+
+func (MediaCommand) isCommand()   {}
+func (MediaCommand) Name() string { return "media" }
+
+// ScreenshotCommand captures a tab as a PNG, written to Out if set or else to
+// the connection.
+type ScreenshotCommand struct {
+	TabID int
+	Out   string
+}
+
+func (ScreenshotCommand) isCommand()   {}
+func (ScreenshotCommand) Name() string { return "screenshot" }
 
 func ParseCommand(line string) (Command, error) {
-	fields := strings.Fields(line)
+	fields, err := splitArgs(line)
+	if err != nil {
+		return nil, err
+	}
 	if len(fields) == 0 {
 		return nil, fmt.Errorf("empty command")
 	}
 
 	switch fields[0] {
 	case "list":
-		return ListCommand{}, nil
+		return parseListCommand(fields[1:])
 	case "select":
-		if len(fields) < 2 {
+		if len(fields) != 2 {
 			return nil, fmt.Errorf("select command requires a TabID")
 		}
 
-		tabID, err := strconv.Atoi(fields[1])
+		tabID, err := ParseTabID(fields[1])
 		if err != nil {
-			return nil, fmt.Errorf("invalid TabID: %s", fields[1])
+			return nil, err
 		}
 
 		return SelectCommand{TabID: tabID}, nil
+	case "version":
+		return VersionCommand{}, nil
+	case "ping":
+		return PingCommand{}, nil
+	case "stats":
+		return StatsCommand{}, nil
+	case "closed":
+		if len(fields) > 1 {
+			return nil, fmt.Errorf("closed takes no arguments")
+		}
+		return ClosedCommand{}, nil
+	case "reopen":
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("reopen takes at most one argument")
+		}
+		c := ReopenCommand{N: 1}
+		if len(fields) == 2 {
+			n, err := strconv.Atoi(fields[1])
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid closed tab number: %q", fields[1])
+			}
+			c.N = n
+		}
+		return c, nil
+	case "undo":
+		if len(fields) > 1 {
+			return nil, fmt.Errorf("undo takes no arguments")
+		}
+		return UndoCommand{}, nil
+	case "session":
+		return parseSessionCommand(fields[1:])
+	case "snapshots":
+		if len(fields) > 1 {
+			return nil, fmt.Errorf("snapshots takes no arguments")
+		}
+		return SnapshotsCommand{}, nil
+	case "snapshot":
+		return parseSnapshotCommand(fields[1:])
+	case "export":
+		return parseExportCommand(fields[1:])
+	case "bookmarks":
+		if len(fields) > 1 {
+			return nil, fmt.Errorf("bookmarks takes no arguments")
+		}
+		return BookmarksCommand{}, nil
+	case "open-bookmark":
+		if len(fields) != 2 || !isBookmarkID(fields[1]) {
+			return nil, fmt.Errorf("open-bookmark command requires a bookmark ID")
+		}
+		return OpenBookmarkCommand{ID: fields[1]}, nil
+	case "bookmark":
+		return parseBookmarkCommand(fields[1:])
+	case "history":
+		return parseHistoryCommand(fields[1:])
+	case "open":
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("open command requires a URL")
+		}
+		if err := checkURL(fields[1]); err != nil {
+			return nil, err
+		}
+		return OpenURLCommand{URL: fields[1]}, nil
+	case "launch":
+		return parseLaunchCommand(fields[1:])
+	case "media":
+		return parseMediaCommand(fields[1:])
+	case "screenshot":
+		return parseScreenshotCommand(fields[1:])
+	case "loglevel":
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("loglevel takes at most one argument")
+		}
+		var c LogLevelCommand
+		if len(fields) == 2 {
+			c.Level = fields[1]
+		}
+		return c, nil
 	default:
 		return nil, fmt.Errorf("unknown command: %s", fields[0])
 	}
 }
+
+// MaxTabID is the largest tab ID accepted from clients. Chrome's IDs are
+// non-negative 32-bit integers, which also keeps them exact in JavaScript.
+const MaxTabID = math.MaxInt32
+
+// ParseTabID parses a tab ID given on the command socket.
+func ParseTabID(s string) (int, error) {
+	id, err := strconv.Atoi(s)
+	if err != nil || id < 0 || id > MaxTabID {
+		return 0, fmt.Errorf("invalid TabID: %q", s)
+	}
+	return id, nil
+}
+
+func parseListCommand(args []string) (Command, error) {
+	var c ListCommand
+	fs := newFlagSet("list")
+	fs.StringVar(&c.Template, "template", "", "row template")
+	fs.StringVar(&c.Browser, "browser", "", "browser product")
+	fs.StringVar(&c.Profile, "profile", "", "profile name or directory")
+	fs.StringVar(&c.Incognito, "incognito", "", "include, exclude or only")
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("list: %v", err)
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("list: unexpected argument: %s", fs.Arg(0))
+	}
+	switch c.Incognito {
+	case "", "include", "exclude", "only":
+	default:
+		return nil, fmt.Errorf("list: invalid incognito mode: %s", c.Incognito)
+	}
+	return c, nil
+}
+
+func parseSessionCommand(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("session: missing action (save, list, restore or delete)")
+	}
+	c := SessionCommand{Action: args[0]}
+	fs := newFlagSet("session " + c.Action)
+	switch c.Action {
+	case "save":
+		fs.IntVar(&c.WindowID, "window", 0, "window to save")
+	case "restore":
+		fs.BoolVar(&c.NewWindow, "new-window", false, "restore into new windows")
+	case "list", "delete":
+	default:
+		return nil, fmt.Errorf("session: unknown action: %s", c.Action)
+	}
+
+	names, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return nil, fmt.Errorf("session %s: %v", c.Action, err)
+	}
+	if c.Action == "list" {
+		if len(names) > 0 {
+			return nil, fmt.Errorf("session list: unexpected argument: %s", names[0])
+		}
+		return c, nil
+	}
+	if len(names) != 1 {
+		return nil, fmt.Errorf("session %s: requires exactly one name", c.Action)
+	}
+	c.Session = names[0]
+	if c.WindowID < 0 {
+		return nil, fmt.Errorf("session save: invalid window: %d", c.WindowID)
+	}
+	return c, nil
+}
+
+func parseSnapshotCommand(args []string) (Command, error) {
+	if len(args) == 0 || args[0] != "restore" {
+		return nil, fmt.Errorf("snapshot: expected restore")
+	}
+	var c SnapshotRestoreCommand
+	fs := newFlagSet("snapshot restore")
+	fs.BoolVar(&c.NewWindow, "new-window", false, "restore into new windows")
+	names, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return nil, fmt.Errorf("snapshot restore: %v", err)
+	}
+	if len(names) != 1 {
+		return nil, fmt.Errorf("snapshot restore: requires exactly one timestamp")
+	}
+	c.Timestamp = names[0]
+	return c, nil
+}
+
+func parseExportCommand(args []string) (Command, error) {
+	var c ExportCommand
+	fs := newFlagSet("export")
+	fs.StringVar(&c.Format, "format", "markdown", "markdown, html, csv, onetab or urls")
+	fs.IntVar(&c.WindowID, "window", 0, "window to export")
+	fs.StringVar(&c.Group, "group", "", "tab group title or ID")
+	if err := fs.Parse(args); err != nil {
+		return nil, fmt.Errorf("export: %v", err)
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("export: unexpected argument: %s", fs.Arg(0))
+	}
+	switch c.Format {
+	case "markdown", "html", "csv", "onetab", "urls":
+	default:
+		return nil, fmt.Errorf("export: invalid format: %s", c.Format)
+	}
+	if c.WindowID < 0 {
+		return nil, fmt.Errorf("export: invalid window: %d", c.WindowID)
+	}
+	return c, nil
+}
+
+// isBookmarkID reports whether s looks like a bookmark ID, which browsers
+// number from 0.
+func isBookmarkID(s string) bool {
+	if s == "" || len(s) > 20 {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func parseBookmarkCommand(args []string) (Command, error) {
+	var c BookmarkCommand
+	fs := newFlagSet("bookmark")
+	fs.StringVar(&c.Folder, "folder", "", "folder path, e.g. 'Bookmarks bar/Work'")
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, fmt.Errorf("bookmark: %v", err)
+	}
+	if len(ids) != 1 {
+		return nil, fmt.Errorf("bookmark command requires a TabID")
+	}
+	if c.TabID, err = ParseTabID(ids[0]); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func parseHistoryCommand(args []string) (Command, error) {
+	c := HistoryCommand{Limit: 50}
+	var since string
+	fs := newFlagSet("history")
+	fs.StringVar(&since, "since", "", "how far back to search, e.g. 7d or 12h")
+	fs.IntVar(&c.Limit, "limit", c.Limit, "maximum number of results")
+	words, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, fmt.Errorf("history: %v", err)
+	}
+	c.Query = strings.Join(words, " ")
+	if since != "" {
+		if c.Since, err = parseSince(since); err != nil {
+			return nil, fmt.Errorf("history: invalid --since: %q", since)
+		}
+	}
+	if c.Limit < 1 || c.Limit > MaxHistoryResults {
+		return nil, fmt.Errorf("history: --limit must be between 1 and %d", MaxHistoryResults)
+	}
+	return c, nil
+}
+
+func parseLaunchCommand(args []string) (Command, error) {
+	c := LaunchCommand{Limit: 100}
+	fs := newFlagSet("launch")
+	fs.IntVar(&c.Limit, "limit", c.Limit, "maximum number of results")
+	words, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, fmt.Errorf("launch: %v", err)
+	}
+	c.Query = strings.Join(words, " ")
+	if c.Limit < 1 || c.Limit > MaxHistoryResults {
+		return nil, fmt.Errorf("launch: --limit must be between 1 and %d", MaxHistoryResults)
+	}
+	return c, nil
+}
+
+func parseMediaCommand(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("media: missing action (list, focus, mute-others or toggle)")
+	}
+	c := MediaCommand{Action: args[0]}
+	var maxArgs, minArgs int
+	switch c.Action {
+	case "list", "focus":
+	case "mute-others":
+		maxArgs = 1
+	case "toggle":
+		minArgs, maxArgs = 1, 1
+	default:
+		return nil, fmt.Errorf("media: unknown action: %s", c.Action)
+	}
+	if n := len(args) - 1; n < minArgs || n > maxArgs {
+		if maxArgs == 0 {
+			return nil, fmt.Errorf("media %s takes no arguments", c.Action)
+		}
+		return nil, fmt.Errorf("media %s: expected a TabID", c.Action)
+	}
+	if len(args) == 2 {
+		id, err := ParseTabID(args[1])
+		if err != nil {
+			return nil, err
+		}
+		c.TabID = id
+	}
+	return c, nil
+}
+
+func parseScreenshotCommand(args []string) (Command, error) {
+	var c ScreenshotCommand
+	fs := newFlagSet("screenshot")
+	fs.StringVar(&c.Out, "out", "", "absolute path of the PNG file to write")
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return nil, fmt.Errorf("screenshot: %v", err)
+	}
+	if len(ids) != 1 {
+		return nil, fmt.Errorf("screenshot command requires a TabID")
+	}
+	if c.TabID, err = ParseTabID(ids[0]); err != nil {
+		return nil, err
+	}
+	// The host runs in the browser's working directory, not the client's
+	if c.Out != "" && !filepath.IsAbs(c.Out) {
+		return nil, fmt.Errorf("screenshot: --out must be an absolute path")
+	}
+	return c, nil
+}
+
+// parseSince parses a positive duration, which may also be given in days
+// such as "7d".
+func parseSince(s string) (time.Duration, error) {
+	var d time.Duration
+	var err error
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		n, err = strconv.Atoi(days)
+		d = time.Duration(n) * 24 * time.Hour
+		if n > 100000 {
+			err = fmt.Errorf("too long")
+		}
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("not positive")
+	}
+	return d, err
+}
+
+// checkURL accepts absolute URLs other than javascript: ones, which would run
+// in the page.
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || strings.EqualFold(u.Scheme, "javascript") {
+		return fmt.Errorf("invalid URL: %q", s)
+	}
+	return nil
+}
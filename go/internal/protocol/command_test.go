@@ -1,6 +1,9 @@
 package protocol
 
-import "testing"
+import (
+	"testing"
+	"time"
+)
 
 func TestParseCommand(t *testing.T) {
 	tests := []struct {
@@ -10,10 +13,86 @@ func TestParseCommand(t *testing.T) {
 		wantErr bool
 	}{
 		{"list", "list", ListCommand{}, false},
+		{"list template", `list --template '{{.Host | pad 20}} {{.Title}}'`, ListCommand{Template: "{{.Host | pad 20}} {{.Title}}"}, false},
+		{"list template double quotes", `list -template "{{.ID}} \"{{.Title}}\""`, ListCommand{Template: `{{.ID}} "{{.Title}}"`}, false},
+		{"list profile", "list --profile Work --browser chrome", ListCommand{Browser: "chrome", Profile: "Work"}, false},
+		{"list incognito", "list --incognito=only", ListCommand{Incognito: "only"}, false},
+		{"list bad incognito", "list --incognito=maybe", nil, true},
+		{"list unknown flag", "list --bogus", nil, true},
+		{"list unterminated quote", "list --template '{{.ID}}", nil, true},
 		{"select ok", "select 123", SelectCommand{TabID: 123}, false},
+		{"stats", "stats", StatsCommand{}, false},
+		{"version", "version", VersionCommand{}, false},
+		{"ping", "ping", PingCommand{}, false},
+		{"loglevel query", "loglevel", LogLevelCommand{}, false},
+		{"loglevel set", "loglevel debug", LogLevelCommand{Level: "debug"}, false},
+		{"loglevel extra", "loglevel debug info", nil, true},
 		{"empty", "", nil, true},
 		{"unknown", "foo", nil, true},
 		{"select bad arg", "select abc", nil, true},
+		{"select negative", "select -1", nil, true},
+		{"select overflow", "select 2147483648", nil, true},
+		{"select max", "select 2147483647", SelectCommand{TabID: 2147483647}, false},
+		{"select extra arg", "select 1 2", nil, true},
+		{"closed", "closed", ClosedCommand{}, false},
+		{"reopen default", "reopen", ReopenCommand{N: 1}, false},
+		{"reopen n", "reopen 3", ReopenCommand{N: 3}, false},
+		{"reopen zero", "reopen 0", nil, true},
+		{"reopen bad arg", "reopen last", nil, true},
+		{"undo", "undo", UndoCommand{}, false},
+		{"undo extra arg", "undo 2", nil, true},
+		{"session save", "session save work", SessionCommand{Action: "save", Session: "work"}, false},
+		{"session save window", "session save --window 12 work", SessionCommand{Action: "save", Session: "work", WindowID: 12}, false},
+		{"session restore new window", "session restore work --new-window", SessionCommand{Action: "restore", Session: "work", NewWindow: true}, false},
+		{"session list", "session list", SessionCommand{Action: "list"}, false},
+		{"session delete", "session delete 'my project'", SessionCommand{Action: "delete", Session: "my project"}, false},
+		{"session missing action", "session", nil, true},
+		{"session unknown action", "session rename a b", nil, true},
+		{"session missing name", "session save", nil, true},
+		{"session two names", "session delete a b", nil, true},
+		{"session list extra", "session list a", nil, true},
+		{"snapshots", "snapshots", SnapshotsCommand{}, false},
+		{"snapshot restore", "snapshot restore 20261018T153000Z --new-window", SnapshotRestoreCommand{Timestamp: "20261018T153000Z", NewWindow: true}, false},
+		{"snapshot missing action", "snapshot", nil, true},
+		{"snapshot missing timestamp", "snapshot restore", nil, true},
+		{"export default", "export", ExportCommand{Format: "markdown"}, false},
+		{"export options", "export --format=csv --window 3 --group 'Project X'", ExportCommand{Format: "csv", WindowID: 3, Group: "Project X"}, false},
+		{"export bad format", "export --format=pdf", nil, true},
+		{"export argument", "export markdown", nil, true},
+		{"bookmarks", "bookmarks", BookmarksCommand{}, false},
+		{"open-bookmark", "open-bookmark 123", OpenBookmarkCommand{ID: "123"}, false},
+		{"open-bookmark bad id", "open-bookmark ../x", nil, true},
+		{"open-bookmark missing id", "open-bookmark", nil, true},
+		{"bookmark", "bookmark 42", BookmarkCommand{TabID: 42}, false},
+		{"bookmark folder", "bookmark --folder 'Bookmarks bar/Work' 42", BookmarkCommand{TabID: 42, Folder: "Bookmarks bar/Work"}, false},
+		{"bookmark bad tab", "bookmark x", nil, true},
+		{"history", "history", HistoryCommand{Limit: 50}, false},
+		{"history query", "history go docs --since 7d --limit 10", HistoryCommand{Query: "go docs", Since: 7 * 24 * time.Hour, Limit: 10}, false},
+		{"history since hours", "history --since=90m", HistoryCommand{Since: 90 * time.Minute, Limit: 50}, false},
+		{"history bad since", "history --since 7w", nil, true},
+		{"history negative since", "history --since -1d", nil, true},
+		{"history bad limit", "history --limit 0", nil, true},
+		{"open", "open https://go.dev/doc/", OpenURLCommand{URL: "https://go.dev/doc/"}, false},
+		{"open relative", "open go.dev", nil, true},
+		{"open javascript", "open javascript:alert(1)", nil, true},
+		{"launch", "launch", LaunchCommand{Limit: 100}, false},
+		{"launch query", "launch go docs --limit 5", LaunchCommand{Query: "go docs", Limit: 5}, false},
+		{"launch bad limit", "launch --limit=-1", nil, true},
+		{"media list", "media list", MediaCommand{Action: "list"}, false},
+		{"media focus", "media focus", MediaCommand{Action: "focus"}, false},
+		{"media mute-others", "media mute-others", MediaCommand{Action: "mute-others"}, false},
+		{"media mute-others tab", "media mute-others 9", MediaCommand{Action: "mute-others", TabID: 9}, false},
+		{"media toggle", "media toggle 9", MediaCommand{Action: "toggle", TabID: 9}, false},
+		{"media toggle missing tab", "media toggle", nil, true},
+		{"media list extra", "media list 9", nil, true},
+		{"media unknown", "media pause", nil, true},
+		{"media missing action", "media", nil, true},
+		{"screenshot", "screenshot 42", ScreenshotCommand{TabID: 42}, false},
+		{"screenshot out", "screenshot --out /tmp/shot.png 42", ScreenshotCommand{TabID: 42, Out: "/tmp/shot.png"}, false},
+		{"screenshot relative out", "screenshot 42 --out shot.png", nil, true},
+		{"screenshot missing tab", "screenshot --out /tmp/shot.png", nil, true},
+		{"screenshot bad tab", "screenshot x", nil, true},
+		{"session restore bad flag", "session restore a --window 3", nil, true},
 	}
 
 	for _, tt := range tests {
@@ -2,18 +2,102 @@ package protocol
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 )
 
+// ErrUnknownEvent is returned by ParseEvent for well-formed events of a type
+// this host does not know, typically from a newer extension.
+var ErrUnknownEvent = errors.New("unknown event type")
+
 type Event interface {
 	isEvent()
+	Type() string
 }
 
 type UpdatedEvent struct {
-	Tabs []Tab `json:"tabs"`
+	Tabs   []Tab   `json:"tabs"`
+	Groups []Group `json:"groups,omitempty"`
+}
+
+func (UpdatedEvent) isEvent()     {}
+func (UpdatedEvent) Type() string { return "updated" }
+
+// HelloEvent is sent by the extension when it connects.
+type HelloEvent struct {
+	ProtocolVersion  int    `json:"protocolVersion"`
+	ExtensionVersion string `json:"extensionVersion"`
+	// Actions lists the action types the extension can perform.
+	Actions []string `json:"actions"`
+	// Browser is the brand reported by navigator.userAgentData, if any.
+	Browser string `json:"browser,omitempty"`
+}
+
+func (HelloEvent) isEvent()     {}
+func (HelloEvent) Type() string { return "hello" }
+
+// BookmarksEvent carries every bookmark, sent on connect and after each
+// change.
+type BookmarksEvent struct {
+	Bookmarks []Bookmark `json:"bookmarks"`
+}
+
+func (BookmarksEvent) isEvent()     {}
+func (BookmarksEvent) Type() string { return "bookmarks" }
+
+// FaviconEvent carries the icon of the pages on a host as a data: URL. The
+// extension sends it once per host and connection, and again when a page
+// changes its icon.
+type FaviconEvent struct {
+	Host string `json:"host"`
+	// Incognito is set when the icon was seen only in incognito tabs.
+	Incognito bool   `json:"incognito,omitempty"`
+	Data      string `json:"data"`
+}
+
+func (FaviconEvent) isEvent()     {}
+func (FaviconEvent) Type() string { return "favicon" }
+
+// ThumbnailEvent carries a small image of a tab the browser showed, as a
+// data: URL. It is only sent when the host asked for thumbnails.
+type ThumbnailEvent struct {
+	TabID int    `json:"tabId"`
+	Data  string `json:"data"`
+}
+
+func (ThumbnailEvent) isEvent()     {}
+func (ThumbnailEvent) Type() string { return "thumbnail" }
+
+// ChunkEvent carries part of the result of a request too large for one
+// message, as base64 that decodes on its own. The chunks of a request come
+// in order, before its ResponseEvent.
+type ChunkEvent struct {
+	RequestID int    `json:"requestId"`
+	Data      string `json:"data"`
+}
+
+func (ChunkEvent) isEvent()     {}
+func (ChunkEvent) Type() string { return "chunk" }
+
+// ResponseEvent answers an action that carried a request ID. Result is
+// specific to the action; Error is set instead when it failed.
+type ResponseEvent struct {
+	RequestID int             `json:"requestId"`
+	Error     string          `json:"error,omitempty"`
+	Result    json.RawMessage `json:"result,omitempty"`
+}
+
+func (ResponseEvent) isEvent()     {}
+func (ResponseEvent) Type() string { return "response" }
+
+// DroppedEvent is never sent by the extension. The event receiver emits it
+// for a message it had to discard, which may have carried tab updates.
+type DroppedEvent struct {
+	Reason string
 }
 
-func (UpdatedEvent) isEvent() {}
+func (DroppedEvent) isEvent()     {}
+func (DroppedEvent) Type() string { return "dropped" }
 
 func unmarshalEvent[T Event](buf []byte) (Event, error) {
 	var e T
@@ -34,7 +118,19 @@ func ParseEvent(buf []byte) (Event, error) {
 	switch header.Type {
 	case "updated":
 		return unmarshalEvent[UpdatedEvent](buf)
+	case "hello":
+		return unmarshalEvent[HelloEvent](buf)
+	case "bookmarks":
+		return unmarshalEvent[BookmarksEvent](buf)
+	case "favicon":
+		return unmarshalEvent[FaviconEvent](buf)
+	case "thumbnail":
+		return unmarshalEvent[ThumbnailEvent](buf)
+	case "chunk":
+		return unmarshalEvent[ChunkEvent](buf)
+	case "response":
+		return unmarshalEvent[ResponseEvent](buf)
 	default:
-		return nil, fmt.Errorf("unknown event type: %s", header.Type)
+		return nil, fmt.Errorf("%w: %s", ErrUnknownEvent, header.Type)
 	}
 }
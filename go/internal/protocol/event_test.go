@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"testing"
 )
 
@@ -52,8 +53,8 @@ func TestParseEvent(t *testing.T) {
 
 func TestParseEventUnknownType(t *testing.T) {
 	payload := []byte(`{"type":"unknown"}`)
-	if _, err := ParseEvent(payload); err == nil {
-		t.Fatalf("expected error for unknown event type")
+	if _, err := ParseEvent(payload); !errors.Is(err, ErrUnknownEvent) {
+		t.Fatalf("ParseEvent() error = %v, want ErrUnknownEvent", err)
 	}
 }
 
@@ -100,3 +101,65 @@ func TestParseEventWithReceiverEncoding(t *testing.T) {
 		t.Fatalf("ParseEvent failed: %v", err)
 	}
 }
+
+func TestParseHelloEvent(t *testing.T) {
+	payload := []byte(`{"type":"hello","protocolVersion":1,"extensionVersion":"1.1","actions":["select"]}`)
+	got, err := ParseEvent(payload)
+	if err != nil {
+		t.Fatalf("ParseEvent failed: %v", err)
+	}
+	hello, ok := got.(HelloEvent)
+	if !ok {
+		t.Fatalf("Expected HelloEvent, got %T", got)
+	}
+	if hello.ProtocolVersion != 1 || hello.ExtensionVersion != "1.1" || len(hello.Actions) != 1 || hello.Actions[0] != "select" {
+		t.Errorf("unexpected hello: %+v", hello)
+	}
+}
+
+func TestParseBookmarksEvent(t *testing.T) {
+	payload := []byte(`{"type":"bookmarks","bookmarks":[{"id":"12","title":"Go","url":"https://go.dev/","path":"Bookmarks bar/Dev"}]}`)
+	got, err := ParseEvent(payload)
+	if err != nil {
+		t.Fatalf("ParseEvent failed: %v", err)
+	}
+	ev, ok := got.(BookmarksEvent)
+	if !ok {
+		t.Fatalf("Expected BookmarksEvent, got %T", got)
+	}
+	want := Bookmark{ID: "12", Title: "Go", URL: "https://go.dev/", Path: "Bookmarks bar/Dev"}
+	if len(ev.Bookmarks) != 1 || ev.Bookmarks[0] != want {
+		t.Errorf("unexpected bookmarks: %+v", ev.Bookmarks)
+	}
+}
+
+func TestParseFaviconEvent(t *testing.T) {
+	payload := []byte(`{"type":"favicon","host":"go.dev","incognito":true,"data":"data:image/png;base64,iVBORw0KGgo="}`)
+	got, err := ParseEvent(payload)
+	if err != nil {
+		t.Fatalf("ParseEvent failed: %v", err)
+	}
+	want := FaviconEvent{Host: "go.dev", Incognito: true, Data: "data:image/png;base64,iVBORw0KGgo="}
+	if got != want {
+		t.Errorf("ParseEvent() = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseChunkAndThumbnailEvents(t *testing.T) {
+	tests := []struct {
+		payload string
+		want    Event
+	}{
+		{`{"type":"chunk","requestId":3,"data":"iVBORw0K"}`, ChunkEvent{RequestID: 3, Data: "iVBORw0K"}},
+		{`{"type":"thumbnail","tabId":7,"data":"data:image/png;base64,iVBORw0K"}`, ThumbnailEvent{TabID: 7, Data: "data:image/png;base64,iVBORw0K"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseEvent([]byte(tt.payload))
+		if err != nil {
+			t.Fatalf("ParseEvent(%s) error = %v", tt.payload, err)
+		}
+		if got != tt.want {
+			t.Errorf("ParseEvent(%s) = %+v, want %+v", tt.payload, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"unicode/utf8"
+
+	"rofi-chrome-tab/internal/nativemsg"
+)
+
+func FuzzParseEvent(f *testing.F) {
+	for _, seed := range []string{
+		`{"type":"updated","tabs":[{"id":1,"title":"Tab1","host":"example.com"}]}`,
+		`{"type":"updated","tabs":[{"id":-1,"title":"","host":"","incognito":true}]}`,
+		`{"type":"updated","tabs":[{"id":1e300}]}`,
+		`{"type":"updated","tabs":null}`,
+		`{"type":"hello","protocolVersion":1,"extensionVersion":"1.1","actions":["select"]}`,
+		"{\"type\":\"updated\",\"tabs\":[{\"id\":1,\"title\":\"\xff\xfe\"}]}",
+		`{"type":1}`,
+		`[]`,
+		``,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		ev, err := ParseEvent(data)
+		if err != nil {
+			return
+		}
+		if e, ok := ev.(UpdatedEvent); ok {
+			for _, tab := range e.Tabs {
+				// encoding/json replaces invalid UTF-8 with U+FFFD
+				if !utf8.ValidString(tab.Title) || !utf8.ValidString(tab.Host) {
+					t.Errorf("invalid UTF-8 in parsed tab %+v", tab)
+				}
+			}
+		}
+	})
+}
+
+func FuzzParseCommand(f *testing.F) {
+	for _, seed := range []string{
+		"list",
+		"list --template '{{.Host | pad 20}} {{.Title}}'",
+		`list --template "{{.ID}} \"x\""`,
+		"list --incognito=only --profile Work",
+		"select 123",
+		"select -5",
+		"select 99999999999999999999",
+		"select 1 2",
+		"loglevel debug",
+		"list --template 'unterminated",
+		"\\",
+		"\xff\xfe",
+		"",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, line string) {
+		cmd, err := ParseCommand(line)
+		if err != nil {
+			if cmd != nil {
+				t.Errorf("ParseCommand(%q) returned %#v with error %v", line, cmd, err)
+			}
+			return
+		}
+		if c, ok := cmd.(SelectCommand); ok && (c.TabID < 0 || c.TabID > MaxTabID) {
+			t.Errorf("ParseCommand(%q) accepted out of range TabID %d", line, c.TabID)
+		}
+	})
+}
+
+func FuzzSendActionRoundTrip(f *testing.F) {
+	for _, seed := range []int{0, 1, 42, MaxTabID, -1} {
+		f.Add(seed, "v1.2.3", true)
+	}
+	f.Add(7, "\xff", false)
+
+	f.Fuzz(func(t *testing.T, tabID int, hostVersion string, accepted bool) {
+		for _, want := range []Action{
+			SelectAction{TabID: tabID},
+			HelloAction{ProtocolVersion: Version, HostVersion: hostVersion, Accepted: accepted, Thumbnails: accepted},
+			ResyncAction{Reason: hostVersion, MaxMessageSize: tabID},
+			ReopenAction{URL: hostVersion, WindowID: tabID, Index: tabID, Pinned: accepted, Incognito: accepted},
+			OpenAction{
+				Tabs:      []OpenTab{{URL: hostVersion, Pinned: accepted, GroupID: tabID}},
+				Groups:    []Group{{ID: tabID, WindowID: tabID, Title: hostVersion, Collapsed: accepted}},
+				NewWindow: accepted,
+			},
+			BookmarkAction{TabID: tabID, Folder: hostVersion},
+			HistoryAction{RequestID: tabID, Query: hostVersion, StartTime: float64(tabID), MaxResults: tabID},
+			MuteAction{TabIDs: []int{tabID, tabID + 1}, Muted: accepted},
+			ScreenshotAction{RequestID: tabID, TabID: tabID},
+		} {
+			var buf bytes.Buffer
+			if err := SendAction(nativemsg.NewWriter(&buf), want); err != nil {
+				t.Fatalf("SendAction(%#v) error = %v", want, err)
+			}
+
+			r := nativemsg.NewReader(&buf, nativemsg.MaxOutgoing)
+			payload, err := r.ReadMessage()
+			if err != nil {
+				t.Fatalf("cannot read framed action: %v", err)
+			}
+			if buf.Len() != 0 {
+				t.Fatalf("%d bytes left after the message", buf.Len())
+			}
+
+			got, err := parseAction(payload)
+			if err != nil {
+				t.Fatalf("parseAction(%s) error = %v", payload, err)
+			}
+			// Invalid UTF-8 is replaced when encoding, so compare the
+			// re-encoded form
+			switch a := want.(type) {
+			case HelloAction:
+				a.HostVersion = string([]rune(a.HostVersion))
+				want = a
+			case ResyncAction:
+				a.Reason = string([]rune(a.Reason))
+				want = a
+			case ReopenAction:
+				a.URL = string([]rune(a.URL))
+				want = a
+			case OpenAction:
+				a.Tabs = []OpenTab{a.Tabs[0]}
+				a.Tabs[0].URL = string([]rune(a.Tabs[0].URL))
+				a.Groups = []Group{a.Groups[0]}
+				a.Groups[0].Title = string([]rune(a.Groups[0].Title))
+				want = a
+			case BookmarkAction:
+				a.Folder = string([]rune(a.Folder))
+				want = a
+			case HistoryAction:
+				a.Query = string([]rune(a.Query))
+				want = a
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("round trip: got %#v, want %#v", got, want)
+			}
+		}
+	})
+}
+
+// parseAction decodes an action as encoded by MarshalAction. The extension is
+// the real decoder; this one checks the encoding.
+func parseAction(buf []byte) (Action, error) {
+	var header struct {
+		Command string `json:"command"`
+	}
+	if err := json.Unmarshal(buf, &header); err != nil {
+		return nil, err
+	}
+
+	switch header.Command {
+	case "select":
+		return unmarshalAction[SelectAction](buf)
+	case "hello":
+		return unmarshalAction[HelloAction](buf)
+	case "resync":
+		return unmarshalAction[ResyncAction](buf)
+	case "reopen":
+		return unmarshalAction[ReopenAction](buf)
+	case "open":
+		return unmarshalAction[OpenAction](buf)
+	case "bookmark":
+		return unmarshalAction[BookmarkAction](buf)
+	case "history":
+		return unmarshalAction[HistoryAction](buf)
+	case "mute":
+		return unmarshalAction[MuteAction](buf)
+	case "screenshot":
+		return unmarshalAction[ScreenshotAction](buf)
+	default:
+		return nil, fmt.Errorf("unknown action: %s", header.Command)
+	}
+}
+
+func unmarshalAction[T Action](buf []byte) (Action, error) {
+	var a T
+	if err := json.Unmarshal(buf, &a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
@@ -1,7 +1,81 @@
 package protocol
 
+import "time"
+
+// Version is the native messaging protocol version spoken by the host. It is
+// bumped on incompatible changes; new message types alone do not need it.
+const Version = 1
+
+// MinVersion is the oldest extension protocol version the host accepts.
+const MinVersion = 1
+
 type Tab struct {
 	ID    int    `json:"id"`
 	Title string `json:"title"`
 	Host  string `json:"host"`
+	URL   string `json:"url,omitempty"`
+	// LastAccessed is the time the tab was last active, in milliseconds since
+	// the epoch.
+	LastAccessed float64 `json:"lastAccessed,omitempty"`
+	Incognito    bool    `json:"incognito,omitempty"`
+	WindowID     int     `json:"windowId,omitempty"`
+	// Index is the tab's position in its window.
+	Index int `json:"index,omitempty"`
+	// GroupID is the tab group, or -1 for none. Older extensions leave it 0.
+	GroupID int  `json:"groupId,omitempty"`
+	Pinned  bool `json:"pinned,omitempty"`
+	// Audible is set while the tab plays sound, even if it is muted.
+	Audible bool `json:"audible,omitempty"`
+	Muted   bool `json:"muted,omitempty"`
+}
+
+// Group is a tab group as reported by chrome.tabGroups.
+type Group struct {
+	ID        int    `json:"id"`
+	WindowID  int    `json:"windowId"`
+	Title     string `json:"title,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Collapsed bool   `json:"collapsed,omitempty"`
+}
+
+// Playing reports whether the tab can be heard.
+func (t Tab) Playing() bool {
+	return t.Audible && !t.Muted
+}
+
+// Bookmark is a bookmarked page. Path is the folder it is in, with folder
+// titles joined by "/", e.g. "Bookmarks bar/Work".
+type Bookmark struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+	URL   string `json:"url"`
+	Path  string `json:"path,omitempty"`
+}
+
+// HistoryItem is a page from the browser history.
+type HistoryItem struct {
+	URL        string `json:"url"`
+	Title      string `json:"title,omitempty"`
+	VisitCount int    `json:"visitCount,omitempty"`
+	// LastVisitTime is in milliseconds since the epoch.
+	LastVisitTime float64 `json:"lastVisitTime,omitempty"`
+}
+
+func (h HistoryItem) LastVisit() time.Time {
+	if h.LastVisitTime == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(h.LastVisitTime))
+}
+
+// Grouped reports whether the tab is in a tab group.
+func (t Tab) Grouped() bool {
+	return t.GroupID > 0
+}
+
+func (t Tab) LastAccessedTime() time.Time {
+	if t.LastAccessed == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(t.LastAccessed))
 }
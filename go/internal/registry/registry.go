@@ -0,0 +1,88 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"rofi-chrome-tab/internal/browser"
+)
+
+// Instance describes a running host. One file per instance is kept next to
+// its command socket so clients can tell browsers and profiles apart.
+type Instance struct {
+	PID         int          `json:"pid"`
+	Socket      string       `json:"socket"`
+	HostVersion string       `json:"hostVersion"`
+	Started     time.Time    `json:"started"`
+	Browser     browser.Info `json:"browser"`
+}
+
+// Path returns the registry file of the host with the given pid.
+func Path(dir string, pid int) string {
+	return filepath.Join(dir, fmt.Sprintf("rofi-chrome-tab.%d.json", pid))
+}
+
+// Write creates or replaces the registry file of inst.
+func Write(dir string, inst Instance) error {
+	data, err := json.MarshalIndent(inst, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := Path(dir, inst.PID)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func Remove(dir string, pid int) error {
+	err := os.Remove(Path(dir, pid))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the registered instances in dir ordered by pid. Entries whose
+// process no longer exists are included; use Alive to tell them apart.
+func List(dir string) ([]Instance, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "rofi-chrome-tab.*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []Instance
+	for _, p := range paths {
+		if strings.HasSuffix(p, ".tmp") {
+			continue
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			continue
+		}
+		var inst Instance
+		if err := json.Unmarshal(data, &inst); err != nil {
+			continue
+		}
+		instances = append(instances, inst)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i].PID < instances[j].PID })
+	return instances, nil
+}
+
+// Alive reports whether the instance's process is still running.
+func (i Instance) Alive() bool {
+	if i.PID <= 0 {
+		return false
+	}
+	err := syscall.Kill(i.PID, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
@@ -0,0 +1,50 @@
+package registry
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/browser"
+)
+
+func TestWriteListRemove(t *testing.T) {
+	dir := t.TempDir()
+	self := Instance{
+		PID:     os.Getpid(),
+		Socket:  "/tmp/native-app.1.sock",
+		Started: time.Unix(1700000000, 0).UTC(),
+		Browser: browser.Info{Product: "Chrome", ProfileName: "Work"},
+	}
+	dead := Instance{PID: 1 << 30, Socket: "/tmp/native-app.2.sock"}
+
+	for _, inst := range []Instance{dead, self} {
+		if err := Write(dir, inst); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	got, err := List(dir)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(got) != 2 || got[0].PID != self.PID || got[1].PID != dead.PID {
+		t.Fatalf("List() = %+v", got)
+	}
+	if got[0].Browser.ProfileName != "Work" || !got[0].Started.Equal(self.Started) {
+		t.Errorf("List()[0] = %+v", got[0])
+	}
+	if !got[0].Alive() || got[1].Alive() {
+		t.Errorf("Alive() = %v, %v; want true, false", got[0].Alive(), got[1].Alive())
+	}
+
+	if err := Remove(dir, dead.PID); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := Remove(dir, dead.PID); err != nil {
+		t.Errorf("Remove() of a missing entry error = %v", err)
+	}
+	if got, _ := List(dir); len(got) != 1 {
+		t.Errorf("List() after Remove = %+v", got)
+	}
+}
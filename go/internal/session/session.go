@@ -0,0 +1,206 @@
+// Package session saves tab state to named files and reads it back. Sessions
+// are stored one JSON file per name under the host's data directory.
+package session
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// Tab is a saved tab. GroupID refers to a group of the same window.
+type Tab struct {
+	URL     string `json:"url"`
+	Title   string `json:"title,omitempty"`
+	Pinned  bool   `json:"pinned,omitempty"`
+	GroupID int    `json:"groupId,omitempty"`
+}
+
+type Group struct {
+	ID        int    `json:"id"`
+	Title     string `json:"title,omitempty"`
+	Color     string `json:"color,omitempty"`
+	Collapsed bool   `json:"collapsed,omitempty"`
+}
+
+// Window is a saved window with its tabs in order.
+type Window struct {
+	Tabs   []Tab   `json:"tabs"`
+	Groups []Group `json:"groups,omitempty"`
+}
+
+type Session struct {
+	Name    string    `json:"name"`
+	Saved   time.Time `json:"saved"`
+	Windows []Window  `json:"windows"`
+}
+
+// TabCount returns the number of tabs in all windows.
+func (s Session) TabCount() int {
+	n := 0
+	for _, w := range s.Windows {
+		n += len(w.Tabs)
+	}
+	return n
+}
+
+// Build collects tabs into windows, ordered as in the browser. Only tabs in
+// windowID are kept unless it is 0, and only those with a URL that satisfy
+// keep.
+func Build(name string, saved time.Time, tabs []protocol.Tab, groups []protocol.Group, windowID int, keep func(protocol.Tab) bool) Session {
+	var order []int
+	byWindow := map[int][]protocol.Tab{}
+	for _, tab := range tabs {
+		if tab.URL == "" || (windowID != 0 && tab.WindowID != windowID) || !keep(tab) {
+			continue
+		}
+		if _, ok := byWindow[tab.WindowID]; !ok {
+			order = append(order, tab.WindowID)
+		}
+		byWindow[tab.WindowID] = append(byWindow[tab.WindowID], tab)
+	}
+
+	s := Session{Name: name, Saved: saved, Windows: []Window{}}
+	for _, id := range order {
+		wtabs := byWindow[id]
+		sort.SliceStable(wtabs, func(i, j int) bool { return wtabs[i].Index < wtabs[j].Index })
+
+		var w Window
+		used := map[int]bool{}
+		for _, tab := range wtabs {
+			t := Tab{URL: tab.URL, Title: tab.Title, Pinned: tab.Pinned}
+			if tab.Grouped() {
+				t.GroupID = tab.GroupID
+				used[tab.GroupID] = true
+			}
+			w.Tabs = append(w.Tabs, t)
+		}
+		for _, g := range groups {
+			if used[g.ID] {
+				w.Groups = append(w.Groups, Group{ID: g.ID, Title: g.Title, Color: g.Color, Collapsed: g.Collapsed})
+			}
+		}
+		s.Windows = append(s.Windows, w)
+	}
+	return s
+}
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._-]*$`)
+
+// ValidName checks that name is usable as a file name.
+func ValidName(name string) error {
+	if len(name) > 100 || !validName.MatchString(name) || strings.HasSuffix(name, ".tmp") {
+		return fmt.Errorf("invalid session name %q: use letters, digits, spaces, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// ErrNotFound is returned for a session that does not exist.
+var ErrNotFound = errors.New("no such session")
+
+// Store keeps sessions in a directory.
+type Store struct {
+	Dir string
+}
+
+func (st Store) path(name string) string {
+	return filepath.Join(st.Dir, name+".json")
+}
+
+// Save writes s under its name, replacing any session of the same name.
+func (st Store) Save(s Session) error {
+	if err := ValidName(s.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(st.Dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	p := st.path(s.Name)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (st Store) Load(name string) (Session, error) {
+	if err := ValidName(name); err != nil {
+		return Session{}, err
+	}
+	data, err := os.ReadFile(st.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return Session{}, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	var s Session
+	if err := json.Unmarshal(data, &s); err != nil {
+		return Session{}, fmt.Errorf("%s: %w", st.path(name), err)
+	}
+	s.Name = name
+	return s, nil
+}
+
+func (st Store) Delete(name string) error {
+	if err := ValidName(name); err != nil {
+		return err
+	}
+	err := os.Remove(st.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return err
+}
+
+// List returns the saved sessions ordered by name. Files that cannot be read
+// are skipped.
+func (st Store) List() ([]Session, error) {
+	paths, err := filepath.Glob(filepath.Join(st.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var sessions []Session
+	for _, p := range paths {
+		name := strings.TrimSuffix(filepath.Base(p), ".json")
+		if s, err := st.Load(name); err == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name < sessions[j].Name })
+	return sessions, nil
+}
+
+// SnapshotName is the name of a snapshot taken at t, e.g. 20261018T153000Z.
+// Names sort by time.
+func SnapshotName(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// Prune deletes all but the keep newest sessions by name, which for
+// snapshots is by time.
+func (st Store) Prune(keep int) error {
+	sessions, err := st.List()
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for i := 0; i < len(sessions)-keep; i++ {
+		if err := st.Delete(sessions[i].Name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,136 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/protocol"
+)
+
+func keepAll(protocol.Tab) bool { return true }
+
+var (
+	tabs = []protocol.Tab{
+		{ID: 3, Title: "Docs", URL: "https://docs.test/", WindowID: 1, Index: 1, GroupID: 7},
+		{ID: 1, Title: "Mail", URL: "https://mail.test/", WindowID: 1, Index: 0, Pinned: true, GroupID: -1},
+		{ID: 5, Title: "News", URL: "https://news.test/", WindowID: 2, Index: 0},
+		{ID: 6, Title: "New Tab", WindowID: 2, Index: 1},
+	}
+	groups = []protocol.Group{
+		{ID: 7, WindowID: 1, Title: "Project", Color: "blue"},
+		{ID: 8, WindowID: 2, Title: "Unused"},
+	}
+)
+
+func TestBuild(t *testing.T) {
+	saved := time.Unix(1700000000, 0)
+	got := Build("work", saved, tabs, groups, 0, keepAll)
+	want := Session{Name: "work", Saved: saved, Windows: []Window{
+		{
+			Tabs: []Tab{
+				{URL: "https://mail.test/", Title: "Mail", Pinned: true},
+				{URL: "https://docs.test/", Title: "Docs", GroupID: 7},
+			},
+			Groups: []Group{{ID: 7, Title: "Project", Color: "blue"}},
+		},
+		{Tabs: []Tab{{URL: "https://news.test/", Title: "News"}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Build() = %+v\nwant %+v", got, want)
+	}
+	if got.TabCount() != 3 {
+		t.Errorf("TabCount() = %d, want 3", got.TabCount())
+	}
+
+	one := Build("news", saved, tabs, groups, 2, keepAll)
+	if len(one.Windows) != 1 || one.TabCount() != 1 {
+		t.Errorf("Build() of window 2 = %+v", one)
+	}
+
+	noMail := Build("x", saved, tabs, groups, 0, func(t protocol.Tab) bool { return t.ID != 1 })
+	if noMail.TabCount() != 2 {
+		t.Errorf("Build() with filter kept %d tabs", noMail.TabCount())
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for _, name := range []string{"work", "My Project", "v1.2_final-2"} {
+		if err := ValidName(name); err != nil {
+			t.Errorf("ValidName(%q) = %v", name, err)
+		}
+	}
+	for _, name := range []string{"", "../etc/passwd", "a/b", ".hidden", "-flag", "x.tmp", "tab\tname"} {
+		if err := ValidName(name); err == nil {
+			t.Errorf("ValidName(%q) accepted", name)
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	st := Store{Dir: filepath.Join(t.TempDir(), "sessions")}
+	saved := time.Unix(1700000000, 0).UTC()
+
+	if list, err := st.List(); err != nil || len(list) != 0 {
+		t.Fatalf("List() on missing dir = %v, %v", list, err)
+	}
+
+	work := Build("work", saved, tabs, groups, 0, keepAll)
+	if err := st.Save(work); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := st.Save(Build("alpha", saved, tabs, nil, 2, keepAll)); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if fi, err := os.Stat(filepath.Join(st.Dir, "work.json")); err != nil || fi.Mode().Perm() != 0600 {
+		t.Errorf("session file = %v, %v", fi, err)
+	}
+
+	got, err := st.Load("work")
+	if err != nil || !reflect.DeepEqual(got, work) {
+		t.Errorf("Load() = %+v, %v", got, err)
+	}
+
+	list, err := st.List()
+	if err != nil || len(list) != 2 || list[0].Name != "alpha" || list[1].Name != "work" {
+		t.Errorf("List() = %+v, %v", list, err)
+	}
+
+	if err := st.Delete("work"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := st.Load("work"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Load() after Delete() error = %v", err)
+	}
+	if err := st.Delete("work"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete() twice error = %v", err)
+	}
+	if err := st.Save(Session{Name: "../escape"}); err == nil {
+		t.Error("Save() accepted an invalid name")
+	}
+}
+
+func TestSnapshotsPrune(t *testing.T) {
+	st := Store{Dir: t.TempDir()}
+	start := time.Date(2026, 10, 18, 15, 30, 0, 0, time.UTC)
+	if got := SnapshotName(start); got != "20261018T153000Z" {
+		t.Errorf("SnapshotName() = %q", got)
+	}
+
+	for i := range 5 {
+		at := start.Add(time.Duration(i) * 10 * time.Minute)
+		if err := st.Save(Build(SnapshotName(at), at, tabs, groups, 0, keepAll)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := st.Prune(2); err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	list, _ := st.List()
+	if len(list) != 2 || list[0].Name != "20261018T160000Z" || list[1].Name != "20261018T161000Z" {
+		t.Errorf("after Prune(2) = %v", list)
+	}
+}
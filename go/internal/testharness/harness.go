@@ -0,0 +1,236 @@
+// Package testharness drives a host end to end: a fake extension speaking
+// native messaging on the host's stdin/stdout and a client for its command
+// socket.
+package testharness
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"rofi-chrome-tab/internal/nativemsg"
+	"rofi-chrome-tab/internal/protocol"
+)
+
+// Timeout bounds every wait in the harness.
+const Timeout = 2 * time.Second
+
+// FakeExtension plays the browser extension. Pass HostStdin and HostStdout
+// to the host under test.
+type FakeExtension struct {
+	t          testing.TB
+	HostStdin  io.Reader
+	HostStdout io.Writer
+	toHost     *io.PipeWriter
+	writer     *nativemsg.Writer
+	actions    chan map[string]any
+}
+
+func NewFakeExtension(t testing.TB) *FakeExtension {
+	t.Helper()
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+
+	f := &FakeExtension{
+		t:          t,
+		HostStdin:  stdinR,
+		HostStdout: stdoutW,
+		toHost:     stdinW,
+		writer:     nativemsg.NewWriter(stdinW),
+		actions:    make(chan map[string]any, 64),
+	}
+	go f.readActions(stdoutR)
+	t.Cleanup(func() {
+		stdinW.Close()
+		stdoutW.Close()
+	})
+	return f
+}
+
+func (f *FakeExtension) readActions(r io.Reader) {
+	defer close(f.actions)
+	reader := nativemsg.NewReader(r, nativemsg.MaxOutgoing)
+	for {
+		buf, err := reader.ReadMessage()
+		if err != nil {
+			if err != io.EOF && err != io.ErrClosedPipe {
+				f.t.Errorf("cannot read action from host: %v", err)
+			}
+			return
+		}
+		var action map[string]any
+		if err := json.Unmarshal(buf, &action); err != nil {
+			f.t.Errorf("host sent invalid JSON %q: %v", buf, err)
+			continue
+		}
+		f.actions <- action
+	}
+}
+
+// Send writes msg to the host as one native message.
+func (f *FakeExtension) Send(msg any) {
+	f.t.Helper()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		f.t.Fatalf("cannot marshal %v: %v", msg, err)
+	}
+	f.SendRaw(data)
+}
+
+// SendRaw frames data as one native message without validating it.
+func (f *FakeExtension) SendRaw(data []byte) {
+	f.t.Helper()
+	if err := f.writer.WriteMessage(data); err != nil {
+		f.t.Fatalf("cannot write to host: %v", err)
+	}
+}
+
+// SendOversized sends a message of size bytes, bypassing the browser's own
+// limit, like a runaway extension.
+func (f *FakeExtension) SendOversized(size int) {
+	f.t.Helper()
+	buf := binary.LittleEndian.AppendUint32(nil, uint32(size))
+	buf = append(buf, bytes.Repeat([]byte{' '}, size)...)
+	if _, err := f.toHost.Write(buf); err != nil {
+		f.t.Fatalf("cannot write to host: %v", err)
+	}
+}
+
+// Hello performs the handshake, announcing actions, and returns the host's
+// reply.
+func (f *FakeExtension) Hello(actions ...string) map[string]any {
+	f.t.Helper()
+	f.Send(map[string]any{
+		"type":             "hello",
+		"protocolVersion":  protocol.Version,
+		"extensionVersion": "test",
+		"actions":          actions,
+	})
+	return f.ExpectAction("hello")
+}
+
+// SendTabs sends an updated event with tabs.
+func (f *FakeExtension) SendTabs(tabs ...protocol.Tab) {
+	f.t.Helper()
+	f.Send(map[string]any{"type": "updated", "tabs": tabs})
+}
+
+// ExpectAction waits for the next action from the host and fails unless its
+// command is typ.
+func (f *FakeExtension) ExpectAction(typ string) map[string]any {
+	f.t.Helper()
+	select {
+	case action, ok := <-f.actions:
+		if !ok {
+			f.t.Fatalf("host closed stdout while waiting for %q", typ)
+		}
+		if action["command"] != typ {
+			f.t.Fatalf("expected action %q, got %v", typ, action)
+		}
+		return action
+	case <-time.After(Timeout):
+		f.t.Fatalf("timeout waiting for action %q", typ)
+	}
+	return nil
+}
+
+// Respond answers an action that carried a request ID with result.
+func (f *FakeExtension) Respond(action map[string]any, result any) {
+	f.t.Helper()
+	f.Send(map[string]any{"type": "response", "requestId": action["requestId"], "result": result})
+}
+
+// ExpectNoAction fails if the host sends an action within d.
+func (f *FakeExtension) ExpectNoAction(d time.Duration) {
+	f.t.Helper()
+	select {
+	case action, ok := <-f.actions:
+		if ok {
+			f.t.Fatalf("unexpected action %v", action)
+		}
+	case <-time.After(d):
+	}
+}
+
+// Disconnect closes the host's stdin like a browser closing the port.
+func (f *FakeExtension) Disconnect() {
+	f.toHost.Close()
+}
+
+// Client talks to a host's command socket.
+type Client struct {
+	t          testing.TB
+	SocketPath string
+}
+
+// NewClient waits for the socket to appear and returns a client for it.
+func NewClient(t testing.TB, socketPath string) *Client {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for socket %s", socketPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return &Client{t: t, SocketPath: socketPath}
+}
+
+// Do sends one command line and returns the whole reply.
+func (c *Client) Do(line string) (string, error) {
+	conn, err := net.Dial("unix", c.SocketPath)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(Timeout))
+
+	if _, err := fmt.Fprintln(conn, line); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(bufio.NewReader(conn))
+	return string(data), err
+}
+
+// Eventually retries line until the reply satisfies ok, since events and
+// commands are handled concurrently.
+func (c *Client) Eventually(line string, ok func(reply string) bool) string {
+	c.t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		reply, err := c.Do(line)
+		if err == nil && ok(reply) {
+			return reply
+		}
+		if time.Now().After(deadline) {
+			c.t.Fatalf("%q: last reply %q, err %v", line, reply, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// WaitGone waits until path no longer exists.
+func WaitGone(t testing.TB, path string) {
+	t.Helper()
+	deadline := time.Now().Add(Timeout)
+	for {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s to be removed", path)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,135 @@
+// Package thumbnail keeps small images of the tabs last shown in the
+// browser, one PNG per tab, so that a picker can preview them.
+package thumbnail
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	// Browsers capture tabs as PNG or JPEG
+	_ "image/jpeg"
+
+	"rofi-chrome-tab/internal/dataurl"
+)
+
+// MaxWidth and MaxHeight bound a thumbnail, so that the extension cannot
+// make the host decode a full size capture.
+const (
+	MaxWidth  = 640
+	MaxHeight = 1280
+)
+
+// Cache keeps the thumbnails of one browser session in a directory, named
+// after their tab ID.
+type Cache struct {
+	Dir string
+	// Keep is the number of thumbnails kept; the oldest are removed first.
+	Keep int
+}
+
+func (c Cache) path(tabID int) string {
+	return filepath.Join(c.Dir, strconv.Itoa(tabID)+".png")
+}
+
+// Lookup returns the file of the thumbnail of a tab, or "" if there is none.
+func (c Cache) Lookup(tabID int) string {
+	p := c.path(tabID)
+	if _, err := os.Stat(p); err != nil {
+		return ""
+	}
+	return p
+}
+
+// Store converts the image in dataURL to PNG and saves it as the thumbnail
+// of a tab, then removes the thumbnails of tabs that are no longer open and
+// the oldest beyond Keep. It returns the file written.
+func (c Cache) Store(tabID int, dataURL string, open func(tabID int) bool) (string, error) {
+	data, err := dataurl.Decode(dataURL)
+	if err != nil {
+		return "", err
+	}
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("unsupported thumbnail: %w", err)
+	}
+	if cfg.Width > MaxWidth || cfg.Height > MaxHeight {
+		return "", fmt.Errorf("%s thumbnail of %dx%d is larger than %dx%d", format, cfg.Width, cfg.Height, MaxWidth, MaxHeight)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("invalid %s thumbnail: %w", format, err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(c.Dir, 0700); err != nil {
+		return "", err
+	}
+	p := c.path(tabID)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0600); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return "", err
+	}
+	return p, c.prune(open)
+}
+
+// prune removes the thumbnails of closed tabs and all but the Keep newest.
+func (c Cache) prune(open func(tabID int) bool) error {
+	entries, err := os.ReadDir(c.Dir)
+	if err != nil {
+		return err
+	}
+	type thumb struct {
+		path    string
+		modTime time.Time
+	}
+	var kept []thumb
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".png")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(name)
+		if err != nil {
+			continue
+		}
+		p := filepath.Join(c.Dir, e.Name())
+		info, err := e.Info()
+		if err != nil || !open(id) {
+			os.Remove(p)
+			continue
+		}
+		kept = append(kept, thumb{p, info.ModTime()})
+	}
+	// Newest first
+	slices.SortFunc(kept, func(a, b thumb) int { return b.modTime.Compare(a.modTime) })
+	for _, t := range kept[min(c.Keep, len(kept)):] {
+		if err := os.Remove(t.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove removes the thumbnail of a tab, if any.
+func (c Cache) Remove(tabID int) {
+	os.Remove(c.path(tabID))
+}
+
+// Clear removes every thumbnail, at the end of the browser session.
+func (c Cache) Clear() error {
+	return os.RemoveAll(c.Dir)
+}
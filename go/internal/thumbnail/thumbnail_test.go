@@ -0,0 +1,101 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func dataURL(t *testing.T, mime string, w, h int) string {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	var buf bytes.Buffer
+	var err error
+	if mime == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, nil)
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "data:" + mime + ";base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+}
+
+func TestStore(t *testing.T) {
+	c := Cache{Dir: filepath.Join(t.TempDir(), "4242"), Keep: 2}
+	open := func(tabID int) bool { return tabID != 9 }
+
+	p, err := c.Store(1, dataURL(t, "image/jpeg", 320, 200), open)
+	if err != nil {
+		t.Fatalf("Store() error = %v", err)
+	}
+	if p != filepath.Join(c.Dir, "1.png") || c.Lookup(1) != p {
+		t.Errorf("Store() = %q, Lookup() = %q", p, c.Lookup(1))
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := png.Decode(bytes.NewReader(data)); err != nil {
+		t.Errorf("thumbnail is not a PNG: %v", err)
+	}
+
+	// The oldest thumbnail and those of closed tabs go
+	past := time.Now().Add(-time.Hour)
+	os.Chtimes(p, past, past)
+	if _, err := c.Store(9, dataURL(t, "image/png", 320, 200), func(int) bool { return true }); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(c.path(9), past.Add(time.Minute), past.Add(time.Minute))
+	if _, err := c.Store(2, dataURL(t, "image/png", 320, 200), open); err != nil {
+		t.Fatal(err)
+	}
+	if c.Lookup(1) == "" || c.Lookup(2) == "" || c.Lookup(9) != "" {
+		t.Errorf("after closing tab 9: 1 %q, 2 %q, 9 %q", c.Lookup(1), c.Lookup(2), c.Lookup(9))
+	}
+	if _, err := c.Store(3, dataURL(t, "image/png", 320, 200), open); err != nil {
+		t.Fatal(err)
+	}
+	if c.Lookup(1) != "" || c.Lookup(2) == "" || c.Lookup(3) == "" {
+		t.Errorf("after third thumbnail: 1 %q, 2 %q, 3 %q", c.Lookup(1), c.Lookup(2), c.Lookup(3))
+	}
+
+	c.Remove(2)
+	if c.Lookup(2) != "" {
+		t.Errorf("Lookup() after Remove = %q", c.Lookup(2))
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(c.Dir); !os.IsNotExist(err) {
+		t.Errorf("Clear() left %s: %v", c.Dir, err)
+	}
+}
+
+func TestStoreErrors(t *testing.T) {
+	c := Cache{Dir: t.TempDir(), Keep: 2}
+	open := func(int) bool { return true }
+	for _, tt := range []struct {
+		name, url, want string
+	}{
+		{"not data", "https://example.com/", "not a data: URL"},
+		{"garbage", "data:image/png;base64,AAAA", "unsupported thumbnail"},
+		{"too large", dataURL(t, "image/png", MaxWidth+1, 10), "larger than"},
+	} {
+		if _, err := c.Store(1, tt.url, open); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: Store() error = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+	if c.Lookup(1) != "" {
+		t.Error("failed Store() left a thumbnail")
+	}
+}
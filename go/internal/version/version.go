@@ -0,0 +1,19 @@
+package version
+
+import "runtime/debug"
+
+// Version is the host version, set at build time with
+// -ldflags "-X rofi-chrome-tab/internal/version.Version=v1.2.3".
+var Version = ""
+
+// String returns Version, falling back to the module version recorded in the
+// binary and then to "dev".
+func String() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return "dev"
+}